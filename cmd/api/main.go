@@ -2,9 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	ch "github.com/ClickHouse/clickhouse-go/v2"
@@ -14,107 +19,267 @@ import (
 	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"github.com/yudgxe/hezzl-test/internal/auth"
+	"github.com/yudgxe/hezzl-test/internal/config"
+	"github.com/yudgxe/hezzl-test/internal/database/sqlc"
 	"github.com/yudgxe/hezzl-test/internal/handlers"
+	"github.com/yudgxe/hezzl-test/internal/metrics"
 	"github.com/yudgxe/hezzl-test/internal/model/clickhouse"
 	"github.com/yudgxe/hezzl-test/internal/tools"
+	"github.com/yudgxe/hezzl-test/internal/tracing"
 
 	_ "github.com/yudgxe/hezzl-test/docs"
 )
 
-var (
-	host string
-	port int
-
-	redisHost     string
-	redisPort     int
-	redisPassword string
-
-	batchSize int
-
-	dbdsn string
-)
-
-func init() {
-	dbdsn = os.Getenv("DBDSN")
-	flag.StringVar(&dbdsn, "dbdsn", dbdsn, "DSN строка для соединения с БД")
+func main() {
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	cfg, _, printed, err := config.Load(os.Args[0], os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("invalid config")
+		os.Exit(2)
+	}
+	if printed {
+		return
+	}
+	if err := run(cfg); err != nil {
+		log.Error().Err(err).Msg("failed to run")
+		os.Exit(1)
+	}
+	log.Info().Msg("stopped")
+}
 
-	flag.StringVar(&host, "host", "localhost", "хост для сервера")
-	flag.IntVar(&port, "port", 8084, "порт для сервера")
+// run - запускает сервер и останавливает его по SIGINT/SIGTERM.
+// Ресурсы закрываются defer в обратном порядке: сервер, relay, воркер, nats, redis, база, clickhouse, трейсы.
+func run(cfg config.Config) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	flag.StringVar(&redisHost, "redis-host", "localhost", "хост для редиса")
-	flag.IntVar(&redisPort, "redis-port", 6379, "порт для редиса")
-	flag.StringVar(&redisPassword, "redis-password", "redis", "пароль от редиса")
+	// shutdownCtx - общий срок на остановку, отсчитывается с момента получения сигнала.
+	shutdownCtx, cancelShutdown := context.WithCancel(context.Background())
+	defer cancelShutdown()
 
-	flag.IntVar(&batchSize, "batch-size", 10, "размера батча логов для оправки в clickhouse")
-	flag.Parse()
-}
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing, "hezzl-api")
+	if err != nil {
+		return fmt.Errorf("setup tracing: %w", err)
+	}
+	defer func() {
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			log.Error().Err(err).Msg("failed to shutdown tracing")
+		}
+	}()
 
-func main() {
-	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 	conn, err := ch.Open(&ch.Options{
-		Addr: []string{"localhost:9000"},
+		Addr: []string{cfg.ClickHouse.Addr},
 		Auth: ch.Auth{
-			Database: "logs",
-			Username: "default",
-			Password: "",
+			Database: cfg.ClickHouse.Database,
+			Username: cfg.ClickHouse.Username,
+			Password: cfg.ClickHouse.Password,
 		},
 	})
 	if err != nil {
-		log.Error().Err(err).Msg("failed to open clickhouse")
-		return
+		return fmt.Errorf("open clickhouse: %w", err)
 	}
+	defer closeLogged("clickhouse", conn.Close)
 
-	if err := conn.Ping(context.Background()); err != nil {
-		log.Error().Err(err).Msg("failed to ping clickhouse")
-		return
+	if err := conn.Ping(ctx); err != nil {
+		return fmt.Errorf("ping clickhouse: %w", err)
 	}
 
-	nc, err := nats.Connect(nats.DefaultURL)
+	poolConfig, err := pgxpool.ParseConfig(cfg.Postgres.DSN)
 	if err != nil {
-		log.Printf("%s\n", err)
-		return
+		return fmt.Errorf("parse dbdsn: %w", err)
 	}
-	defer nc.Close()
-
-	ec, err := nats.NewEncodedConn(nc, nats.JSON_ENCODER)
+	connectCtx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	pool, err := pgxpool.ConnectConfig(connectCtx, poolConfig)
 	if err != nil {
-		log.Error().Err(err).Msg("failed to get nats json encoder")
-		return
+		return fmt.Errorf("connect to db: %w", err)
 	}
-
-	tools.NewWorker[clickhouse.Good](ec, tools.NewGoodSender(conn), batchSize).Start("logs.good")
+	defer pool.Close()
+	metrics.Registry.MustRegister(metrics.NewPoolCollector(pool))
+	db := tracing.NewDB(pool)
 
 	client := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%d", redisHost, redisPort),
-		Password: redisPassword,
+		Addr:     fmt.Sprintf("%s:%d", cfg.Redis.Host, cfg.Redis.Port),
+		Password: cfg.Redis.Password,
 		DB:       0,
 	})
+	defer closeLogged("redis", client.Close)
+	client.AddHook(tracing.RedisHook{})
 
-	// health checkse
-	if err := client.Ping(context.Background()).Err(); err != nil {
-		log.Error().Err(err).Msg("failed to ping redis")
+	cache := tools.NewCache(client)
+
+	// Redis не обязателен: пока он недоступен, api работает без кеша.
+	guard := tools.NewRedisGuard(client, cfg.Health.RedisInterval, cfg.Health.Timeout, cache.DelCached)
+	guard.Start()
+	defer guard.Stop()
+
+	nc, err := nats.Connect(cfg.NATS.URL)
+	if err != nil {
+		return fmt.Errorf("connect to nats: %w", err)
 	}
+	defer func() {
+		if err := nc.FlushTimeout(time.Second); err != nil {
+			log.Error().Err(err).Msg("failed to flush nats")
+		}
+		nc.Close()
+	}()
 
-	cfg, err := pgxpool.ParseConfig(dbdsn)
+	ec, err := nats.NewEncodedConn(nc, nats.JSON_ENCODER)
 	if err != nil {
-		log.Error().Err(err).Msg("failed to parse dbdsn")
+		return fmt.Errorf("get nats json encoder: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancel()
-	pool, err := pgxpool.ConnectConfig(ctx, cfg)
+	var js nats.JetStreamContext
+	if cfg.NATS.Mode == "jetstream" || strings.HasPrefix(cfg.Worker.DeadLetter, "nats:") {
+		if js, err = nc.JetStream(); err != nil {
+			return fmt.Errorf("get jetstream: %w", err)
+		}
+	}
+	dl, err := newDeadLetter(cfg.Worker.DeadLetter, js)
 	if err != nil {
-		log.Error().Err(err).Msg("failed to connect to db")
+		return fmt.Errorf("create dead letter %q: %w", cfg.Worker.DeadLetter, err)
 	}
-	defer pool.Close()
+	goodSender, err := tools.NewClickHouseSender[clickhouse.Good](conn, "goods")
+	if err != nil {
+		return fmt.Errorf("create clickhouse sender: %w", err)
+	}
+	sender := tools.NewRetrySender[clickhouse.Good](goodSender, tools.RetryPolicy{
+		Attempts:       cfg.Worker.RetryAttempts,
+		InitialBackoff: cfg.Worker.RetryBackoff,
+		MaxBackoff:     cfg.Worker.RetryMaxBackoff,
+		Jitter:         0.5,
+	}, dl)
+
+	var worker tools.LogWorker
+	switch cfg.NATS.Mode {
+	case "core":
+		worker = tools.NewWorker[clickhouse.Good](ec, sender, cfg.Worker.BatchSize, cfg.Worker.FlushInterval)
+	case "jetstream":
+		if err := tools.EnsureLogsStream(js); err != nil {
+			return fmt.Errorf("create logs stream: %w", err)
+		}
+		worker = tools.NewJetStreamWorker[clickhouse.Good](js, cfg.NATS.Durable, sender, cfg.Worker.BatchSize, cfg.Worker.FlushInterval)
+	default:
+		return fmt.Errorf("unknown nats mode %q", cfg.NATS.Mode)
+	}
+	if err := worker.Start("logs.good"); err != nil {
+		return fmt.Errorf("start worker: %w", err)
+	}
+	defer func() {
+		if err := worker.Stop(shutdownCtx); err != nil {
+			log.Error().Err(err).Msg("failed to stop worker")
+		}
+	}()
+
+	relay := tools.NewOutboxRelay(db, nc, js, cfg.Outbox.BatchSize, cfg.Outbox.Interval)
+	relay.Start()
+	defer func() {
+		if err := relay.Stop(shutdownCtx); err != nil {
+			log.Error().Err(err).Msg("failed to stop outbox relay")
+		}
+	}()
+
+	handlersConfig := handlers.Config{AdminToken: cfg.Auth.AdminToken, TrustedProxies: cfg.Server.Proxies()}
+	if handlersConfig.RateLimit.IP, err = tools.ParseRateLimit(cfg.RateLimit.IP); err != nil {
+		return fmt.Errorf("parse rate-limit-ip: %w", err)
+	}
+	if handlersConfig.RateLimit.Read, err = tools.ParseRateLimit(cfg.RateLimit.Read); err != nil {
+		return fmt.Errorf("parse rate-limit-read: %w", err)
+	}
+	if handlersConfig.RateLimit.Write, err = tools.ParseRateLimit(cfg.RateLimit.Write); err != nil {
+		return fmt.Errorf("parse rate-limit-write: %w", err)
+	}
+	if cfg.Auth.Mode == "none" {
+		log.Warn().Msg("authentication is disabled")
+	} else {
+		var chain auth.Chain
+		for _, mode := range strings.Split(cfg.Auth.Mode, ",") {
+			switch strings.TrimSpace(mode) {
+			case "apikey":
+				chain = append(chain, auth.NewAPIKeyAuthenticator(sqlc.New(db)))
+			case "jwt":
+				keys, err := auth.LoadJWTKeySet(cfg.Auth.JWTKeys)
+				if err != nil {
+					return fmt.Errorf("load jwt keys from %q: %w", cfg.Auth.JWTKeys, err)
+				}
+				chain = append(chain, auth.NewJWTAuthenticator(keys, cfg.Auth.JWTIssuer, cfg.Auth.JWTAudience))
+			default:
+				return fmt.Errorf("unknown auth mode %q", mode)
+			}
+		}
+		handlersConfig.Auth = chain
+	}
+	handlersConfig.Health = tools.NewHealthChecker(cfg.Health.Timeout,
+		tools.HealthCheck{Name: "postgres", Critical: true, Check: pool.Ping},
+		tools.HealthCheck{Name: "redis", Check: func(ctx context.Context) error {
+			return client.Ping(ctx).Err()
+		}},
+		tools.HealthCheck{Name: "nats", Critical: true, Check: func(context.Context) error {
+			if status := nc.Status(); status != nats.CONNECTED {
+				return fmt.Errorf("connection is %s", status)
+			}
+			return nil
+		}},
+		// Логи копятся в nats, пока clickhouse недоступен, поэтому api продолжает работать.
+		tools.HealthCheck{Name: "clickhouse", Check: conn.Ping},
+	)
 
 	r := gin.New()
 	r.Use(gin.Recovery())
 
-	client.FlushAll(context.TODO())
+	srv := &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port),
+		Handler: handlers.Urls(db, cache, &log.Logger, handlersConfig, r),
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Info().Str("addr", srv.Addr).Msg("starting server")
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+		}
+		close(serveErr)
+	}()
 
-	cache := tools.NewCache(client)
-	if err := handlers.Urls(pool, cache, &log.Logger, ec, r).Run(fmt.Sprintf("%s:%d", host, port)); err != nil {
-		log.Error().Err(err).Str("host", host).Int("port", port).Msg("failed to start server")
+	select {
+	case <-ctx.Done():
+		log.Info().Dur("timeout", cfg.Server.ShutdownTimeout).Msg("shutting down")
+	case err = <-serveErr:
+		err = fmt.Errorf("serve: %w", err)
+	}
+	time.AfterFunc(cfg.Server.ShutdownTimeout, cancelShutdown)
+
+	// Перестаем принимать соединения и ждем текущие запросы, остальное закроют defer.
+	if shutdownErr := srv.Shutdown(shutdownCtx); shutdownErr != nil {
+		log.Error().Err(shutdownErr).Msg("failed to shutdown server")
+	}
+	return err
+}
+
+// closeLogged - закрывает ресурс, логируя ошибку.
+func closeLogged(name string, close func() error) {
+	if err := close(); err != nil {
+		log.Error().Err(err).Str("resource", name).Msg("failed to close")
+	}
+}
+
+// newDeadLetter - dead letter из настройки worker.dead_letter, nil если она пустая.
+func newDeadLetter(deadLetter string, js nats.JetStreamContext) (tools.DeadLetter, error) {
+	kind, target, _ := strings.Cut(deadLetter, ":")
+	switch {
+	case deadLetter == "":
+		return nil, nil
+	case kind == "file" && target != "":
+		return tools.NewFileDeadLetter(target)
+	case kind == "nats" && target != "":
+		if err := tools.EnsureDeadLetterStream(js); err != nil {
+			return nil, err
+		}
+		return tools.NewNATSDeadLetter(js, tools.DeadLetterSubjectPrefix+target), nil
+	default:
+		return nil, fmt.Errorf("invalid dead letter %q", deadLetter)
 	}
 }
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/urfave/cli/v2"
+	"github.com/yudgxe/hezzl-test/internal/auth"
+	"github.com/yudgxe/hezzl-test/internal/config"
+	"github.com/yudgxe/hezzl-test/internal/database/sqlc"
+)
+
+// main - флаги общих настроек идут до команды, например apikey -dbdsn ... list.
+func main() {
+	cfg, rest, printed, err := config.Load(os.Args[0], os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if printed {
+		return
+	}
+	app := &cli.App{
+		Name:  "apikey",
+		Usage: "управление ключами api",
+		Commands: []*cli.Command{
+			newIssueCommand(cfg.Postgres),
+			newRevokeCommand(cfg.Postgres),
+			newListCommand(cfg.Postgres),
+		},
+	}
+	if err := app.Run(append([]string{os.Args[0]}, rest...)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// connect - подключение к базе из общих настроек.
+func connect(c *cli.Context, cfg config.Postgres) (*pgxpool.Pool, error) {
+	ctx, cancel := context.WithTimeout(c.Context, time.Second*5)
+	defer cancel()
+	return pgxpool.Connect(ctx, cfg.DSN)
+}
+
+func newIssueCommand(db config.Postgres) *cli.Command {
+	return &cli.Command{
+		Name:  "issue",
+		Usage: "выдать новый ключ",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "name", Usage: "имя ключа", Required: true},
+			&cli.StringSliceFlag{Name: "project", Usage: "доступ к проекту в виде id:read или id:write, можно указать несколько раз"},
+			&cli.BoolFlag{Name: "admin", Usage: "доступ ко всем проектам и админским ручкам"},
+		},
+		Action: func(c *cli.Context) error {
+			projects, err := parseProjects(c.StringSlice("project"))
+			if err != nil {
+				return err
+			}
+			pool, err := connect(c, db)
+			if err != nil {
+				return err
+			}
+			defer pool.Close()
+
+			key, err := auth.GenerateAPIKey()
+			if err != nil {
+				return err
+			}
+
+			tx, err := pool.Begin(c.Context)
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback(context.Background())
+
+			q := sqlc.New(tx)
+			apiKey, err := q.CreateAPIKey(c.Context, sqlc.CreateAPIKeyParams{
+				Name:    c.String("name"),
+				KeyHash: auth.HashAPIKey(key),
+				IsAdmin: c.Bool("admin"),
+			})
+			if err != nil {
+				return err
+			}
+			for projectID, scope := range projects {
+				if err := q.SetAPIKeyProject(c.Context, sqlc.SetAPIKeyProjectParams{
+					ApiKeyID:  apiKey.ID,
+					ProjectID: projectID,
+					Scope:     string(scope),
+				}); err != nil {
+					return err
+				}
+			}
+			if err := tx.Commit(c.Context); err != nil {
+				return err
+			}
+
+			fmt.Printf("id:  %d\nkey: %s\n", apiKey.ID, key)
+			fmt.Fprintln(os.Stderr, "ключ показывается только один раз, сохраните его")
+			return nil
+		},
+	}
+}
+
+func newRevokeCommand(db config.Postgres) *cli.Command {
+	return &cli.Command{
+		Name:  "revoke",
+		Usage: "отозвать ключ",
+		Flags: []cli.Flag{
+			&cli.IntFlag{Name: "id", Usage: "id ключа", Required: true},
+		},
+		Action: func(c *cli.Context) error {
+			pool, err := connect(c, db)
+			if err != nil {
+				return err
+			}
+			defer pool.Close()
+
+			apiKey, err := sqlc.New(pool).RevokeAPIKey(c.Context, int32(c.Int("id")))
+			if errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("key %d not found or already revoked", c.Int("id"))
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Printf("revoked %d (%s)\n", apiKey.ID, apiKey.Name)
+			return nil
+		},
+	}
+}
+
+func newListCommand(db config.Postgres) *cli.Command {
+	return &cli.Command{
+		Name:  "list",
+		Usage: "список ключей",
+		Action: func(c *cli.Context) error {
+			pool, err := connect(c, db)
+			if err != nil {
+				return err
+			}
+			defer pool.Close()
+
+			q := sqlc.New(pool)
+			keys, err := q.ListAPIKeys(c.Context)
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tNAME\tADMIN\tPROJECTS\tCREATED\tREVOKED")
+			for _, key := range keys {
+				projects, err := q.ListAPIKeyProjects(c.Context, key.ID)
+				if err != nil {
+					return err
+				}
+				scopes := make([]string, 0, len(projects))
+				for _, p := range projects {
+					scopes = append(scopes, fmt.Sprintf("%d:%s", p.ProjectID, p.Scope))
+				}
+				revoked := "-"
+				if key.RevokedAt.Valid {
+					revoked = key.RevokedAt.Time.Format(time.RFC3339)
+				}
+				fmt.Fprintf(w, "%d\t%s\t%t\t%s\t%s\t%s\n", key.ID, key.Name, key.IsAdmin,
+					strings.Join(scopes, ","), key.CreatedAt.Format(time.RFC3339), revoked)
+			}
+			return w.Flush()
+		},
+	}
+}
+
+// parseProjects - разбирает доступы вида id:scope.
+func parseProjects(values []string) (map[int32]auth.Scope, error) {
+	projects := make(map[int32]auth.Scope, len(values))
+	for _, v := range values {
+		id, scope, ok := strings.Cut(v, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid project %q, expected id:read or id:write", v)
+		}
+		projectID, err := strconv.ParseInt(id, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid project id %q: %w", id, err)
+		}
+		if s := auth.Scope(scope); s != auth.ScopeRead && s != auth.ScopeWrite {
+			return nil, fmt.Errorf("invalid scope %q, expected read or write", scope)
+		}
+		projects[int32(projectID)] = auth.Scope(scope)
+	}
+	return projects, nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	ch "github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/urfave/cli/v2"
+	"github.com/yudgxe/hezzl-test/internal/config"
+	"github.com/yudgxe/hezzl-test/internal/model/clickhouse"
+	"github.com/yudgxe/hezzl-test/internal/tools"
+)
+
+// main - флаги общих настроек идут до команды, например replay -clickhouse-addr ch:9000 file.
+// Каталог и тема dead letter по умолчанию берутся из worker.dead_letter.
+func main() {
+	cfg, rest, printed, err := config.Load(os.Args[0], os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if printed {
+		return
+	}
+	app := &cli.App{
+		Name:  "replay",
+		Usage: "повторная отправка в clickhouse пачек из dead letter",
+		Commands: []*cli.Command{
+			newFileCommand(cfg),
+			newNATSCommand(cfg),
+		},
+	}
+	if err := app.Run(append([]string{os.Args[0]}, rest...)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// deadLetterTarget - каталог или тема из worker.dead_letter, если он нужного вида.
+func deadLetterTarget(cfg config.Config, kind string) string {
+	if k, target, ok := strings.Cut(cfg.Worker.DeadLetter, ":"); ok && k == kind {
+		return target
+	}
+	return ""
+}
+
+// newSender - отправка логов товаров в clickhouse.
+func newSender(ctx context.Context, cfg config.ClickHouse) (tools.Sender[clickhouse.Good], error) {
+	conn, err := ch.Open(&ch.Options{
+		Addr: []string{cfg.Addr},
+		Auth: ch.Auth{
+			Database: cfg.Database,
+			Username: cfg.Username,
+			Password: cfg.Password,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Ping(ctx); err != nil {
+		return nil, err
+	}
+	return tools.NewClickHouseSender[clickhouse.Good](conn, "goods")
+}
+
+// replay - отправляет одну сохраненную пачку.
+func replay(ctx context.Context, sender tools.Sender[clickhouse.Good], data []byte) (int, error) {
+	var record tools.DeadLetterRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return 0, err
+	}
+	var goods []clickhouse.Good
+	if err := json.Unmarshal(record.Items, &goods); err != nil {
+		return 0, err
+	}
+	return len(goods), sender.Send(ctx, goods)
+}
+
+func newFileCommand(cfg config.Config) *cli.Command {
+	return &cli.Command{
+		Name:  "file",
+		Usage: "отправить пачки из каталога, отправленные файлы удаляются",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "dir", Usage: "каталог dead letter", Value: deadLetterTarget(cfg, "file")},
+		},
+		Action: func(c *cli.Context) error {
+			if c.String("dir") == "" {
+				return errors.New("dir is required, worker.dead_letter is not a file dead letter")
+			}
+			deadLetter, err := tools.NewFileDeadLetter(c.String("dir"))
+			if err != nil {
+				return err
+			}
+			files, err := deadLetter.Files()
+			if err != nil {
+				return err
+			}
+			sender, err := newSender(c.Context, cfg.ClickHouse)
+			if err != nil {
+				return err
+			}
+
+			var total int
+			for _, file := range files {
+				data, err := os.ReadFile(file)
+				if err != nil {
+					return err
+				}
+				n, err := replay(c.Context, sender, data)
+				if err != nil {
+					// Оставшиеся файлы не трогаем, чтобы не нарушить порядок.
+					return fmt.Errorf("%s: %w", file, err)
+				}
+				if err := os.Remove(file); err != nil {
+					return err
+				}
+				total += n
+			}
+			fmt.Printf("replayed %d batches, %d goods\n", len(files), total)
+			return nil
+		},
+	}
+}
+
+func newNATSCommand(cfg config.Config) *cli.Command {
+	subject := ""
+	if target := deadLetterTarget(cfg, "nats"); target != "" {
+		subject = tools.DeadLetterSubjectPrefix + target
+	}
+	return &cli.Command{
+		Name:  "nats",
+		Usage: "отправить пачки из стрима JetStream, отправленные сообщения подтверждаются",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "subject", Usage: "тема dead letter", Value: subject},
+			&cli.StringFlag{Name: "durable", Usage: "имя durable consumer", Value: "replay"},
+		},
+		Action: func(c *cli.Context) error {
+			if c.String("subject") == "" {
+				return errors.New("subject is required, worker.dead_letter is not a nats dead letter")
+			}
+			nc, err := nats.Connect(cfg.NATS.URL)
+			if err != nil {
+				return err
+			}
+			defer nc.Close()
+			js, err := nc.JetStream()
+			if err != nil {
+				return err
+			}
+			sub, err := js.PullSubscribe(c.String("subject"), c.String("durable"), nats.BindStream(tools.DeadLetterStream))
+			if err != nil {
+				return err
+			}
+			sender, err := newSender(c.Context, cfg.ClickHouse)
+			if err != nil {
+				return err
+			}
+
+			var batches, total int
+			for {
+				msgs, err := sub.Fetch(1, nats.MaxWait(2*time.Second))
+				if errors.Is(err, nats.ErrTimeout) {
+					break
+				}
+				if err != nil {
+					return err
+				}
+				msg := msgs[0]
+				n, err := replay(c.Context, sender, msg.Data)
+				if err != nil {
+					if nakErr := msg.Nak(); nakErr != nil {
+						log.Println("failed to nak:", nakErr)
+					}
+					return err
+				}
+				if err := msg.AckSync(); err != nil {
+					return err
+				}
+				batches++
+				total += n
+			}
+			fmt.Printf("replayed %d batches, %d goods\n", batches, total)
+			return nil
+		},
+	}
+}
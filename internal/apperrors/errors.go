@@ -0,0 +1,197 @@
+// Package apperrors - каталог ошибок api. У каждой ошибки стабильный код и сообщение,
+// по которым клиент понимает, что произошло. Внутренние ошибки драйверов оборачиваются
+// и клиенту не показываются.
+package apperrors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindValidation
+	KindNotFound
+	KindConflict
+	KindForbidden
+	KindPrecondition
+	KindUnavailable
+	KindUnprocessable
+	KindUnauthorized
+	KindTooManyRequests
+)
+
+// Error - ошибка api.
+type Error struct {
+	Kind Kind
+	// Code - стабильный код ошибки, отдается клиенту.
+	Code int
+	// Message - ключ сообщения вида errors.good.notFound, отдается клиенту.
+	Message string
+	// Details - детали для клиента, например ошибки полей.
+	Details interface{}
+	// Err - исходная ошибка, клиенту не отдается.
+	Err error
+}
+
+func New(kind Kind, code int, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Is - ошибки из каталога сравниваются по коду и сообщению, так Wrap и WithDetails не ломают errors.Is.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code && t.Message == e.Message
+}
+
+// Wrap - копия ошибки с исходной причиной.
+func (e *Error) Wrap(err error) *Error {
+	c := *e
+	c.Err = err
+	return &c
+}
+
+// WithDetails - копия ошибки с деталями для клиента.
+func (e *Error) WithDetails(details interface{}) *Error {
+	c := *e
+	c.Details = details
+	return &c
+}
+
+// Status - http статус ошибки.
+func (e *Error) Status() int {
+	switch e.Kind {
+	case KindValidation:
+		return http.StatusBadRequest
+	case KindNotFound:
+		return http.StatusNotFound
+	case KindConflict:
+		return http.StatusConflict
+	case KindForbidden:
+		return http.StatusForbidden
+	case KindPrecondition:
+		return http.StatusPreconditionFailed
+	case KindUnavailable:
+		return http.StatusServiceUnavailable
+	case KindUnprocessable:
+		return http.StatusUnprocessableEntity
+	case KindUnauthorized:
+		return http.StatusUnauthorized
+	case KindTooManyRequests:
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Каталог ошибок по порядку кодов. У каждой ошибки свой код, коды не меняются, новые ошибки получают следующий свободный код.
+var (
+	ErrValidation            = New(KindValidation, 0, "errors.validation")
+	ErrInternal              = New(KindInternal, 1, "errors.internal")
+	ErrForbidden             = New(KindForbidden, 2, "errors.forbidden")
+	ErrGoodNotFound          = New(KindNotFound, 3, "errors.good.notFound")
+	ErrVersionMismatch       = New(KindPrecondition, 4, "errors.good.versionMismatch")
+	ErrConflict              = New(KindConflict, 5, "errors.conflict")
+	ErrUniqueViolation       = New(KindConflict, 6, "errors.db.uniqueViolation")
+	ErrForeignKey            = New(KindUnprocessable, 7, "errors.db.foreignKeyViolation")
+	ErrCacheUnavailable      = New(KindUnavailable, 8, "errors.cache.unavailable")
+	ErrIdempotencyKeyReused  = New(KindUnprocessable, 9, "errors.idempotency.keyReused")
+	ErrUnauthorized          = New(KindUnauthorized, 10, "errors.unauthorized")
+	ErrRateLimited           = New(KindTooManyRequests, 11, "errors.rateLimited")
+	ErrNotFound              = New(KindNotFound, 12, "errors.notFound")
+	ErrProjectNotFound       = New(KindNotFound, 13, "errors.project.notFound")
+	ErrInvalidCursor         = New(KindValidation, 14, "errors.goods.invalidCursor")
+	ErrCursorSort            = New(KindValidation, 15, "errors.goods.cursorSortNotSupported")
+	ErrUnknownFormat         = New(KindValidation, 16, "errors.goods.unknownFormat")
+	ErrNameRequired          = New(KindValidation, 17, "errors.good.nameRequired")
+	ErrNameTooLong           = New(KindValidation, 18, "errors.good.nameTooLong")
+	ErrCSVNameColumn         = New(KindValidation, 19, "errors.goods.csvNameColumnRequired")
+	ErrBatchEmpty            = New(KindValidation, 20, "errors.batch.empty")
+	ErrBatchTooMany          = New(KindValidation, 21, "errors.batch.tooManyOperations")
+	ErrBatchUnknownOperation = New(KindValidation, 22, "errors.batch.unknownOperation")
+	ErrAdminForbidden        = New(KindForbidden, 23, "errors.admin.forbidden")
+	ErrProjectForbidden      = New(KindForbidden, 24, "errors.project.forbidden")
+	ErrProjectRequired       = New(KindValidation, 25, "errors.goods.projectRequired")
+	ErrIdempotencyInProgress = New(KindConflict, 26, "errors.idempotency.inProgress")
+)
+
+// FieldError - ошибка поля запроса.
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+	Param  string `json:"param,omitempty"`
+}
+
+// Validation - ошибка валидации запроса с деталями по полям, если их удалось достать из err.
+func Validation(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	var ve validator.ValidationErrors
+	if errors.As(err, &ve) {
+		fields := make([]FieldError, 0, len(ve))
+		for _, fe := range ve {
+			fields = append(fields, FieldError{Field: fe.Field(), Reason: fe.Tag(), Param: fe.Param()})
+		}
+		return ErrValidation.Wrap(err).WithDetails(fields)
+	}
+	var te *json.UnmarshalTypeError
+	if errors.As(err, &te) {
+		return ErrValidation.Wrap(err).WithDetails([]FieldError{{Field: te.Field, Reason: "type", Param: te.Type.String()}})
+	}
+	var se *json.SyntaxError
+	if errors.As(err, &se) {
+		return ErrValidation.Wrap(err).WithDetails([]FieldError{{Field: "body", Reason: "syntax"}})
+	}
+	return ErrValidation.Wrap(err)
+}
+
+// Field - ошибка значения конкретного поля, например параметра url.
+func Field(field string, err error) *Error {
+	reason := "invalid"
+	var ne *strconv.NumError
+	if errors.As(err, &ne) {
+		reason = ne.Err.Error()
+	}
+	return ErrValidation.Wrap(err).WithDetails([]FieldError{{Field: field, Reason: reason}})
+}
+
+// From - приводит любую ошибку к ошибке каталога.
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound.Wrap(err)
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23505":
+			return ErrUniqueViolation.Wrap(err).WithDetails(map[string]string{"constraint": pgErr.ConstraintName})
+		case "23503":
+			return ErrForeignKey.Wrap(err).WithDetails(map[string]string{"constraint": pgErr.ConstraintName})
+		}
+	}
+	return ErrInternal.Wrap(err)
+}
@@ -0,0 +1,159 @@
+package apperrors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// TestCatalogUnique - читает каталог из исходника, поэтому новые ошибки проверяются без списка в тесте.
+func TestCatalogUnique(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "errors.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes := make(map[string]string)
+	messages := make(map[string]string)
+	last := -1
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vs := spec.(*ast.ValueSpec)
+			for i, value := range vs.Values {
+				call, ok := value.(*ast.CallExpr)
+				if !ok || fmt.Sprint(call.Fun) != "New" {
+					continue
+				}
+				name := vs.Names[i].Name
+				code := call.Args[1].(*ast.BasicLit).Value
+				message, _ := strconv.Unquote(call.Args[2].(*ast.BasicLit).Value)
+				if n, _ := strconv.Atoi(code); n <= last {
+					t.Errorf("%s: code %s is out of order, previous code is %d", name, code, last)
+				} else {
+					last = n
+				}
+				if other, ok := codes[code]; ok {
+					t.Errorf("%s and %s share code %s", name, other, code)
+				}
+				if other, ok := messages[message]; ok {
+					t.Errorf("%s and %s share message %s", name, other, message)
+				}
+				codes[code], messages[message] = name, name
+			}
+		}
+	}
+	if len(codes) == 0 {
+		t.Fatal("catalog not found")
+	}
+}
+
+// TestCatalogStable - коды, которые клиенты получали до появления каталога.
+func TestCatalogStable(t *testing.T) {
+	for expected, err := range map[int]*Error{0: ErrValidation, 1: ErrInternal, 3: ErrGoodNotFound} {
+		if err.Code != expected {
+			t.Errorf("%s: expected code %d, got %d", err.Message, expected, err.Code)
+		}
+	}
+}
+
+func TestStatus(t *testing.T) {
+	for kind, expected := range map[Kind]int{
+		KindInternal:        http.StatusInternalServerError,
+		KindValidation:      http.StatusBadRequest,
+		KindNotFound:        http.StatusNotFound,
+		KindConflict:        http.StatusConflict,
+		KindForbidden:       http.StatusForbidden,
+		KindPrecondition:    http.StatusPreconditionFailed,
+		KindUnavailable:     http.StatusServiceUnavailable,
+		KindUnprocessable:   http.StatusUnprocessableEntity,
+		KindUnauthorized:    http.StatusUnauthorized,
+		KindTooManyRequests: http.StatusTooManyRequests,
+	} {
+		if got := New(kind, 0, "test").Status(); got != expected {
+			t.Errorf("kind %d: expected %d, got %d", kind, expected, got)
+		}
+	}
+}
+
+func TestFrom(t *testing.T) {
+	unique := &pgconn.PgError{Code: "23505", ConstraintName: "goods_pkey"}
+	tests := []struct {
+		name     string
+		err      error
+		expected *Error
+		details  interface{}
+	}{
+		{name: "catalog", err: ErrGoodNotFound, expected: ErrGoodNotFound},
+		{name: "wrapped catalog", err: fmt.Errorf("get: %w", ErrVersionMismatch.Wrap(errors.New("cause"))), expected: ErrVersionMismatch},
+		{name: "no rows", err: fmt.Errorf("get: %w", pgx.ErrNoRows), expected: ErrNotFound},
+		{name: "unique", err: unique, expected: ErrUniqueViolation, details: map[string]string{"constraint": "goods_pkey"}},
+		{name: "foreign key", err: &pgconn.PgError{Code: "23503", ConstraintName: "goods_project_id_fkey"}, expected: ErrForeignKey, details: map[string]string{"constraint": "goods_project_id_fkey"}},
+		{name: "other postgres", err: &pgconn.PgError{Code: "40001"}, expected: ErrInternal},
+		{name: "unknown", err: errors.New("connection reset"), expected: ErrInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := From(tt.err)
+			if !errors.Is(got, tt.expected) {
+				t.Fatalf("expected %s, got %s", tt.expected.Message, got.Message)
+			}
+			if tt.details != nil && !reflect.DeepEqual(got.Details, tt.details) {
+				t.Errorf("expected details %v, got %v", tt.details, got.Details)
+			}
+			var e *Error
+			if !errors.As(tt.err, &e) && got.Err != tt.err {
+				t.Errorf("expected cause %v to be kept, got %v", tt.err, got.Err)
+			}
+		})
+	}
+}
+
+func TestValidation(t *testing.T) {
+	var body struct {
+		Name string `json:"name" validate:"required"`
+	}
+	validationErr := validator.New().Struct(body)
+	var typeErr error = json.Unmarshal([]byte(`{"name": 1}`), &body)
+	syntaxErr := json.Unmarshal([]byte(`{`), &body)
+
+	tests := []struct {
+		name     string
+		err      error
+		expected *Error
+		details  interface{}
+	}{
+		{name: "catalog", err: ErrNameRequired, expected: ErrNameRequired},
+		{name: "validator", err: validationErr, expected: ErrValidation, details: []FieldError{{Field: "Name", Reason: "required"}}},
+		{name: "type", err: typeErr, expected: ErrValidation, details: []FieldError{{Field: "name", Reason: "type", Param: "string"}}},
+		{name: "syntax", err: syntaxErr, expected: ErrValidation, details: []FieldError{{Field: "body", Reason: "syntax"}}},
+		{name: "other", err: errors.New("EOF"), expected: ErrValidation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Validation(tt.err)
+			if !errors.Is(got, tt.expected) {
+				t.Fatalf("expected %s, got %s", tt.expected.Message, got.Message)
+			}
+			if got.Status() != http.StatusBadRequest {
+				t.Errorf("expected status %d, got %d", http.StatusBadRequest, got.Status())
+			}
+			if !reflect.DeepEqual(got.Details, tt.details) {
+				t.Errorf("expected details %#v, got %#v", tt.details, got.Details)
+			}
+		})
+	}
+}
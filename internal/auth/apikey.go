@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/yudgxe/hezzl-test/internal/database/sqlc"
+)
+
+const (
+	// APIKeyHeader - заголовок с ключом api.
+	APIKeyHeader = "X-API-Key"
+
+	apiKeyPrefix = "hz_"
+)
+
+// GenerateAPIKey - новый случайный ключ, показывается один раз при выдаче.
+func GenerateAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + hex.EncodeToString(b), nil
+}
+
+// HashAPIKey - хеш ключа, под которым он хранится в базе.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyStore - запросы к базе, нужные для проверки ключей.
+type APIKeyStore interface {
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (sqlc.ApiKey, error)
+	ListAPIKeyProjects(ctx context.Context, apiKeyID int32) ([]sqlc.ListAPIKeyProjectsRow, error)
+}
+
+var _ Authenticator = (*APIKeyAuthenticator)(nil)
+
+// APIKeyAuthenticator - аутентификация по ключу из заголовка X-API-Key.
+type APIKeyAuthenticator struct {
+	store APIKeyStore
+}
+
+func NewAPIKeyAuthenticator(store APIKeyStore) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{
+		store: store,
+	}
+}
+
+func (a *APIKeyAuthenticator) Authenticate(ctx context.Context, r *http.Request) (*Principal, error) {
+	key := strings.TrimSpace(r.Header.Get(APIKeyHeader))
+	if key == "" {
+		return nil, ErrUnauthenticated
+	}
+	apiKey, err := a.store.GetAPIKeyByHash(ctx, HashAPIKey(key))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUnauthenticated
+		}
+		return nil, err
+	}
+	// Запрос уже отбрасывает отозванные ключи, проверка на случай другого хранилища.
+	if apiKey.RevokedAt.Valid {
+		return nil, ErrUnauthenticated
+	}
+	projects, err := a.store.ListAPIKeyProjects(ctx, apiKey.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	principal := &Principal{
+		Subject:  fmt.Sprintf("apikey:%d", apiKey.ID),
+		Admin:    apiKey.IsAdmin,
+		Projects: make(map[int32]Scope, len(projects)),
+	}
+	for _, project := range projects {
+		principal.Projects[project.ProjectID] = Scope(project.Scope)
+	}
+	return principal, nil
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/yudgxe/hezzl-test/internal/database/sqlc"
+)
+
+// fakeAPIKeyStore - ключи по хешу, как в таблице api_keys.
+type fakeAPIKeyStore struct {
+	keys     map[string]sqlc.ApiKey
+	projects map[int32][]sqlc.ListAPIKeyProjectsRow
+	err      error
+}
+
+func (s *fakeAPIKeyStore) GetAPIKeyByHash(ctx context.Context, keyHash string) (sqlc.ApiKey, error) {
+	if s.err != nil {
+		return sqlc.ApiKey{}, s.err
+	}
+	key, ok := s.keys[keyHash]
+	if !ok {
+		return sqlc.ApiKey{}, pgx.ErrNoRows
+	}
+	return key, nil
+}
+
+func (s *fakeAPIKeyStore) ListAPIKeyProjects(ctx context.Context, apiKeyID int32) ([]sqlc.ListAPIKeyProjectsRow, error) {
+	return s.projects[apiKeyID], nil
+}
+
+func TestAPIKeyAuthenticator(t *testing.T) {
+	store := &fakeAPIKeyStore{
+		keys: map[string]sqlc.ApiKey{
+			HashAPIKey("hz_reader"):  {ID: 1},
+			HashAPIKey("hz_admin"):   {ID: 2, IsAdmin: true},
+			HashAPIKey("hz_revoked"): {ID: 3, RevokedAt: sql.NullTime{Time: time.Now(), Valid: true}},
+		},
+		projects: map[int32][]sqlc.ListAPIKeyProjectsRow{
+			1: {{ProjectID: 1, Scope: string(ScopeRead)}, {ProjectID: 2, Scope: string(ScopeWrite)}},
+		},
+	}
+	failing := &fakeAPIKeyStore{err: errors.New("connection refused")}
+
+	tests := []struct {
+		name     string
+		store    APIKeyStore
+		key      string
+		expected *Principal
+		err      error
+	}{
+		{name: "no key", store: store, err: ErrUnauthenticated},
+		{name: "unknown key", store: store, key: "hz_unknown", err: ErrUnauthenticated},
+		{name: "plain key is not a hash", store: store, key: HashAPIKey("hz_reader"), err: ErrUnauthenticated},
+		{name: "revoked", store: store, key: "hz_revoked", err: ErrUnauthenticated},
+		{name: "store error", store: failing, key: "hz_reader", err: failing.err},
+		{
+			name: "projects", store: store, key: " hz_reader ",
+			expected: &Principal{Subject: "apikey:1", Projects: map[int32]Scope{1: ScopeRead, 2: ScopeWrite}},
+		},
+		{
+			name: "admin", store: store, key: "hz_admin",
+			expected: &Principal{Subject: "apikey:2", Admin: true, Projects: map[int32]Scope{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.key != "" {
+				r.Header.Set(APIKeyHeader, tt.key)
+			}
+			principal, err := NewAPIKeyAuthenticator(tt.store).Authenticate(context.Background(), r)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if !reflect.DeepEqual(principal, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, principal)
+			}
+		})
+	}
+}
+
+func TestPrincipalCan(t *testing.T) {
+	p := &Principal{Projects: map[int32]Scope{1: ScopeRead, 2: ScopeWrite}}
+	tests := []struct {
+		project  int32
+		scope    Scope
+		expected bool
+	}{
+		{1, ScopeRead, true},
+		{1, ScopeWrite, false},
+		{2, ScopeRead, true},
+		{2, ScopeWrite, true},
+		{3, ScopeRead, false},
+	}
+	for _, tt := range tests {
+		if got := p.Can(tt.project, tt.scope); got != tt.expected {
+			t.Errorf("project %d scope %s: expected %v, got %v", tt.project, tt.scope, tt.expected, got)
+		}
+	}
+	admin := &Principal{Admin: true}
+	if !admin.Can(3, ScopeWrite) {
+		t.Error("expected admin to write any project")
+	}
+}
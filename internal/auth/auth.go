@@ -0,0 +1,46 @@
+// Package auth - аутентификация клиентов api и проверка их доступа к проектам.
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// ErrUnauthenticated - клиент не передал данные для входа или они неверные.
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+type Scope string
+
+const (
+	ScopeRead  Scope = "read"
+	ScopeWrite Scope = "write"
+)
+
+// Principal - аутентифицированный клиент.
+type Principal struct {
+	// Subject - идентификатор клиента для логов и аудита.
+	Subject string
+	// Admin - доступ ко всем проектам и админским ручкам.
+	Admin bool
+	// Projects - проекты, к которым есть доступ.
+	Projects map[int32]Scope
+}
+
+// Can - есть ли у клиента доступ scope к проекту, write включает в себя read.
+func (p *Principal) Can(projectID int32, scope Scope) bool {
+	if p.Admin {
+		return true
+	}
+	granted, ok := p.Projects[projectID]
+	if !ok {
+		return false
+	}
+	return granted == ScopeWrite || granted == scope
+}
+
+// Authenticator - способ аутентификации клиента по http запросу.
+type Authenticator interface {
+	// Authenticate - возвращает клиента или ErrUnauthenticated.
+	Authenticate(ctx context.Context, r *http.Request) (*Principal, error)
+}
@@ -0,0 +1,23 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+var _ Authenticator = Chain(nil)
+
+// Chain - пробует способы аутентификации по очереди, пока один из них не узнает клиента.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(ctx context.Context, r *http.Request) (*Principal, error) {
+	for _, a := range c {
+		principal, err := a.Authenticate(ctx, r)
+		if errors.Is(err, ErrUnauthenticated) {
+			continue
+		}
+		return principal, err
+	}
+	return nil, ErrUnauthenticated
+}
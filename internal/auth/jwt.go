@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWTClaims - claims токена, которые понимает api.
+type JWTClaims struct {
+	jwt.RegisteredClaims
+	// Admin - доступ ко всем проектам и админским ручкам.
+	Admin bool `json:"admin,omitempty"`
+	// Projects - проекты с доступом, ключ - id проекта, значение - read или write.
+	Projects map[string]Scope `json:"projects,omitempty"`
+}
+
+// jwtKeySetFile - формат файла с ключами.
+//
+//	{"keys": [
+//		{"kid": "sso-hs", "alg": "HS256", "secret": "<base64>"},
+//		{"kid": "sso-rs", "alg": "RS256", "public_key": "-----BEGIN PUBLIC KEY-----..."}
+//	]}
+type jwtKeySetFile struct {
+	Keys []struct {
+		Kid       string `json:"kid"`
+		Alg       string `json:"alg"`
+		Secret    string `json:"secret"`
+		PublicKey string `json:"public_key"`
+	} `json:"keys"`
+}
+
+type jwtKey struct {
+	alg string
+	key interface{}
+}
+
+// JWTKeySet - ключи для проверки подписи токенов по kid.
+type JWTKeySet struct {
+	keys map[string]jwtKey
+}
+
+// LoadJWTKeySet - читает ключи из json файла.
+func LoadJWTKeySet(path string) (*JWTKeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWTKeySet(data)
+}
+
+// ParseJWTKeySet - разбирает ключи в формате файла LoadJWTKeySet.
+func ParseJWTKeySet(data []byte) (*JWTKeySet, error) {
+	var file jwtKeySetFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	set := &JWTKeySet{keys: make(map[string]jwtKey, len(file.Keys))}
+	for _, k := range file.Keys {
+		if _, ok := set.keys[k.Kid]; ok {
+			return nil, fmt.Errorf("duplicate kid %q", k.Kid)
+		}
+		switch k.Alg {
+		case jwt.SigningMethodHS256.Alg():
+			secret, err := base64.StdEncoding.DecodeString(k.Secret)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+			}
+			if len(secret) == 0 {
+				return nil, fmt.Errorf("key %q: empty secret", k.Kid)
+			}
+			set.keys[k.Kid] = jwtKey{alg: k.Alg, key: secret}
+		case jwt.SigningMethodRS256.Alg():
+			key, err := jwt.ParseRSAPublicKeyFromPEM([]byte(k.PublicKey))
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+			}
+			set.keys[k.Kid] = jwtKey{alg: k.Alg, key: key}
+		default:
+			return nil, fmt.Errorf("key %q: unsupported alg %q", k.Kid, k.Alg)
+		}
+	}
+	if len(set.keys) == 0 {
+		return nil, errors.New("empty key set")
+	}
+	return set, nil
+}
+
+// keyFunc - ключ для проверки токена. Без kid подходит только единственный ключ набора.
+// Алгоритм токена должен совпадать с алгоритмом ключа, иначе публичный RS256 ключ
+// можно было бы использовать как секрет HS256.
+func (s *JWTKeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := s.keys[kid]
+	if !ok && kid == "" && len(s.keys) == 1 {
+		for _, k := range s.keys {
+			key, ok = k, true
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	if token.Method.Alg() != key.alg {
+		return nil, fmt.Errorf("unexpected alg %q for kid %q", token.Method.Alg(), kid)
+	}
+	return key.key, nil
+}
+
+var _ Authenticator = (*JWTAuthenticator)(nil)
+
+// JWTAuthenticator - аутентификация по bearer токену из заголовка Authorization.
+type JWTAuthenticator struct {
+	keys   *JWTKeySet
+	parser *jwt.Parser
+}
+
+// NewJWTAuthenticator - issuer и audience проверяются, только если не пустые.
+func NewJWTAuthenticator(keys *JWTKeySet, issuer, audience string) *JWTAuthenticator {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg(), jwt.SigningMethodRS256.Alg()}),
+		jwt.WithExpirationRequired(),
+	}
+	if issuer != "" {
+		opts = append(opts, jwt.WithIssuer(issuer))
+	}
+	if audience != "" {
+		opts = append(opts, jwt.WithAudience(audience))
+	}
+	return &JWTAuthenticator{
+		keys:   keys,
+		parser: jwt.NewParser(opts...),
+	}
+}
+
+func (a *JWTAuthenticator) Authenticate(ctx context.Context, r *http.Request) (*Principal, error) {
+	header := r.Header.Get("Authorization")
+	raw, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || raw == "" {
+		return nil, ErrUnauthenticated
+	}
+
+	var claims JWTClaims
+	if _, err := a.parser.ParseWithClaims(strings.TrimSpace(raw), &claims, a.keys.keyFunc); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnauthenticated, err)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: empty subject", ErrUnauthenticated)
+	}
+
+	principal := &Principal{
+		Subject:  "jwt:" + claims.Subject,
+		Admin:    claims.Admin,
+		Projects: make(map[int32]Scope, len(claims.Projects)),
+	}
+	for id, scope := range claims.Projects {
+		projectID, err := strconv.ParseInt(id, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid project id %q", ErrUnauthenticated, id)
+		}
+		if scope != ScopeRead && scope != ScopeWrite {
+			return nil, fmt.Errorf("%w: invalid scope %q", ErrUnauthenticated, scope)
+		}
+		principal.Projects[int32(projectID)] = scope
+	}
+	return principal, nil
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func writeKeySet(t *testing.T, secret []byte, public *rsa.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{"kid": "hs", "alg": "HS256", "secret": base64.StdEncoding.EncodeToString(secret)},
+			{"kid": "rs", "alg": "RS256", "public_key": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	secret := []byte("secret")
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := LoadJWTKeySet(writeKeySet(t, secret, &private.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewJWTAuthenticator(keys, "sso", "")
+
+	claims := func(exp time.Duration) JWTClaims {
+		return JWTClaims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:   "user",
+				Issuer:    "sso",
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(exp)),
+			},
+			Projects: map[string]Scope{"1": ScopeWrite, "2": ScopeRead},
+		}
+	}
+	sign := func(method jwt.SigningMethod, kid string, claims JWTClaims, key interface{}) string {
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = kid
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		err   bool
+	}{
+		{"hs256", sign(jwt.SigningMethodHS256, "hs", claims(time.Minute), secret), false},
+		{"rs256", sign(jwt.SigningMethodRS256, "rs", claims(time.Minute), private), false},
+		{"expired", sign(jwt.SigningMethodHS256, "hs", claims(-time.Minute), secret), true},
+		{"unknown kid", sign(jwt.SigningMethodHS256, "other", claims(time.Minute), secret), true},
+		{"wrong secret", sign(jwt.SigningMethodHS256, "hs", claims(time.Minute), []byte("other")), true},
+		{"alg mismatch", sign(jwt.SigningMethodHS256, "rs", claims(time.Minute), secret), true},
+		{"no token", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			p, err := a.Authenticate(context.Background(), r)
+			if tt.err {
+				if !errors.Is(err, ErrUnauthenticated) {
+					t.Fatalf("expected ErrUnauthenticated, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Subject != "jwt:user" {
+				t.Errorf("subject %q", p.Subject)
+			}
+			if !p.Can(1, ScopeWrite) || !p.Can(2, ScopeRead) || p.Can(2, ScopeWrite) || p.Can(3, ScopeRead) {
+				t.Errorf("projects %v", p.Projects)
+			}
+		})
+	}
+}
@@ -0,0 +1,394 @@
+// Package config - настройки сервисов. Значения берутся по возрастанию приоритета
+// из значений по умолчанию, yaml файла, переменных окружения и флагов.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config - настройки api и воркеров.
+//
+// Теги полей: yaml - ключ в файле, env - переменная окружения, flag - имя флага,
+// usage - описание флага, secret - значение скрывается в --print-config.
+type Config struct {
+	Server     Server     `yaml:"server"`
+	Postgres   Postgres   `yaml:"postgres"`
+	Redis      Redis      `yaml:"redis"`
+	ClickHouse ClickHouse `yaml:"clickhouse"`
+	NATS       NATS       `yaml:"nats"`
+	Worker     Worker     `yaml:"worker"`
+	Outbox     Outbox     `yaml:"outbox"`
+	Auth       Auth       `yaml:"auth"`
+	RateLimit  RateLimit  `yaml:"rate_limit"`
+	Health     Health     `yaml:"health"`
+	Tracing    Tracing    `yaml:"tracing"`
+}
+
+type Server struct {
+	Host            string        `yaml:"host" env:"API_HOST" flag:"host" usage:"хост для сервера"`
+	Port            int           `yaml:"port" env:"API_PORT" flag:"port" usage:"порт для сервера"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" flag:"shutdown-timeout" usage:"сколько ждать остановки сервера, воркера и соединений"`
+	TrustedProxies  string        `yaml:"trusted_proxies" env:"TRUSTED_PROXIES" flag:"trusted-proxies" usage:"ip или подсети прокси через запятую, которым верим в X-Forwarded-For, пусто - ip клиента берется из соединения"`
+}
+
+// Proxies - список из TrustedProxies, nil если он пустой.
+func (s Server) Proxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(s.TrustedProxies, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+type Postgres struct {
+	DSN string `yaml:"dsn" env:"DBDSN" flag:"dbdsn" usage:"DSN строка для соединения с БД" secret:"true"`
+}
+
+type Redis struct {
+	Host     string `yaml:"host" env:"REDIS_HOST" flag:"redis-host" usage:"хост для редиса"`
+	Port     int    `yaml:"port" env:"REDIS_PORT" flag:"redis-port" usage:"порт для редиса"`
+	Password string `yaml:"password" env:"REDIS_PASSWORD" flag:"redis-password" usage:"пароль от редиса" secret:"true"`
+}
+
+type ClickHouse struct {
+	Addr     string `yaml:"addr" env:"CLICKHOUSE_ADDR" flag:"clickhouse-addr" usage:"адрес clickhouse в виде host:port"`
+	Database string `yaml:"database" env:"CLICKHOUSE_DATABASE" flag:"clickhouse-database" usage:"база clickhouse"`
+	Username string `yaml:"username" env:"CLICKHOUSE_USERNAME" flag:"clickhouse-username" usage:"пользователь clickhouse"`
+	Password string `yaml:"password" env:"CLICKHOUSE_PASSWORD" flag:"clickhouse-password" usage:"пароль clickhouse" secret:"true"`
+}
+
+type NATS struct {
+	URL     string `yaml:"url" env:"NATS_URL" flag:"nats-url" usage:"адрес nats"`
+	Mode    string `yaml:"mode" env:"NATS_MODE" flag:"nats-mode" usage:"режим доставки логов: core - без гарантий, jetstream - durable consumer"`
+	Durable string `yaml:"durable" env:"NATS_DURABLE" flag:"nats-durable" usage:"имя durable consumer в режиме jetstream"`
+}
+
+type Worker struct {
+	BatchSize       int           `yaml:"batch_size" env:"BATCH_SIZE" flag:"batch-size" usage:"размера батча логов для оправки в clickhouse"`
+	FlushInterval   time.Duration `yaml:"flush_interval" env:"FLUSH_INTERVAL" flag:"flush-interval" usage:"как часто отправлять в clickhouse неполный батч логов"`
+	RetryAttempts   int           `yaml:"retry_attempts" env:"RETRY_ATTEMPTS" flag:"retry-attempts" usage:"сколько раз пытаться отправить батч логов в clickhouse"`
+	RetryBackoff    time.Duration `yaml:"retry_backoff" env:"RETRY_BACKOFF" flag:"retry-backoff" usage:"пауза после первой неудачной отправки, дальше удваивается"`
+	RetryMaxBackoff time.Duration `yaml:"retry_max_backoff" env:"RETRY_MAX_BACKOFF" flag:"retry-max-backoff" usage:"максимальная пауза между отправками"`
+	DeadLetter      string        `yaml:"dead_letter" env:"DEAD_LETTER" flag:"dead-letter" usage:"куда складывать неотправленные батчи: file:<каталог>, nats:<тема> или пусто - выбрасывать"`
+}
+
+type Outbox struct {
+	BatchSize int           `yaml:"batch_size" env:"OUTBOX_BATCH_SIZE" flag:"outbox-batch-size" usage:"сколько событий outbox отправляется в nats за раз"`
+	Interval  time.Duration `yaml:"interval" env:"OUTBOX_INTERVAL" flag:"outbox-interval" usage:"период опроса outbox"`
+}
+
+type Auth struct {
+	Mode        string `yaml:"mode" env:"AUTH" flag:"auth" usage:"аутентификация клиентов через запятую: apikey, jwt или none"`
+	AdminToken  string `yaml:"admin_token" env:"ADMIN_TOKEN" flag:"admin-token" usage:"токен для админских ручек, пустой - админские ручки отключены" secret:"true"`
+	JWTKeys     string `yaml:"jwt_keys" env:"JWT_KEYS" flag:"jwt-keys" usage:"json файл с ключами для проверки jwt"`
+	JWTIssuer   string `yaml:"jwt_issuer" env:"JWT_ISSUER" flag:"jwt-issuer" usage:"ожидаемый iss в jwt, пустой - не проверяется"`
+	JWTAudience string `yaml:"jwt_audience" env:"JWT_AUDIENCE" flag:"jwt-audience" usage:"ожидаемый aud в jwt, пустой - не проверяется"`
+}
+
+type RateLimit struct {
+	IP    string `yaml:"ip" env:"RATE_LIMIT_IP" flag:"rate-limit-ip" usage:"лимит запросов с одного ip до аутентификации в виде запросы/окно, 0 - без ограничений"`
+	Read  string `yaml:"read" env:"RATE_LIMIT_READ" flag:"rate-limit-read" usage:"лимит запросов на чтение на клиента в виде запросы/окно, 0 - без ограничений"`
+	Write string `yaml:"write" env:"RATE_LIMIT_WRITE" flag:"rate-limit-write" usage:"лимит запросов на запись на клиента в виде запросы/окно, 0 - без ограничений"`
+}
+
+type Health struct {
+	Timeout       time.Duration `yaml:"timeout" env:"HEALTH_TIMEOUT" flag:"health-timeout" usage:"таймаут проверки одной зависимости в /readyz"`
+	RedisInterval time.Duration `yaml:"redis_interval" env:"HEALTH_REDIS_INTERVAL" flag:"health-redis-interval" usage:"как часто проверять redis, пока он недоступен запросы идут без кеша"`
+}
+
+type Tracing struct {
+	Exporter     string  `yaml:"exporter" env:"TRACING_EXPORTER" flag:"tracing-exporter" usage:"куда отправлять трейсы: none, stdout, file или otlp"`
+	File         string  `yaml:"file" env:"TRACING_FILE" flag:"tracing-file" usage:"файл для трейсов в формате json lines при exporter: file"`
+	OTLPEndpoint string  `yaml:"otlp_endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT" flag:"tracing-otlp-endpoint" usage:"адрес otlp/http коллектора при exporter: otlp"`
+	SampleRatio  float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO" flag:"tracing-sample-ratio" usage:"доля запросов, для которых пишутся трейсы, от 0 до 1"`
+}
+
+// Default - значения по умолчанию, подходят для docker-compose из репозитория.
+func Default() Config {
+	return Config{
+		Server: Server{
+			Host:            "localhost",
+			Port:            8084,
+			ShutdownTimeout: 15 * time.Second,
+		},
+		Redis: Redis{
+			Host:     "localhost",
+			Port:     6379,
+			Password: "redis",
+		},
+		ClickHouse: ClickHouse{
+			Addr:     "localhost:9000",
+			Database: "logs",
+			Username: "default",
+		},
+		NATS: NATS{
+			URL:     "nats://127.0.0.1:4222",
+			Mode:    "jetstream",
+			Durable: "clickhouse-goods",
+		},
+		Worker: Worker{
+			BatchSize:       10,
+			FlushInterval:   5 * time.Second,
+			RetryAttempts:   5,
+			RetryBackoff:    time.Second,
+			RetryMaxBackoff: 30 * time.Second,
+			DeadLetter:      "file:deadletter",
+		},
+		Outbox: Outbox{
+			BatchSize: 100,
+			Interval:  time.Second,
+		},
+		Auth: Auth{
+			Mode: "apikey",
+		},
+		RateLimit: RateLimit{
+			IP:    "1200/1m",
+			Read:  "600/1m",
+			Write: "120/1m",
+		},
+		Health: Health{
+			Timeout:       time.Second,
+			RedisInterval: 5 * time.Second,
+		},
+		Tracing: Tracing{
+			Exporter:     "none",
+			File:         "traces.jsonl",
+			OTLPEndpoint: "localhost:4318",
+			SampleRatio:  1,
+		},
+	}
+}
+
+// Validate - проверяет значения, которые не зависят от внешних сервисов.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	check(c.Server.Port > 0 && c.Server.Port < 65536, "server.port: invalid port %d", c.Server.Port)
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout: must be positive")
+	for _, proxy := range c.Server.Proxies() {
+		_, _, cidrErr := net.ParseCIDR(proxy)
+		check(cidrErr == nil || net.ParseIP(proxy) != nil, "server.trusted_proxies: invalid ip or subnet %q", proxy)
+	}
+	check(c.Redis.Port > 0 && c.Redis.Port < 65536, "redis.port: invalid port %d", c.Redis.Port)
+	if err := c.ClickHouse.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	check(c.NATS.URL != "", "nats.url: required")
+	check(c.NATS.Mode == "core" || c.NATS.Mode == "jetstream", "nats.mode: expected core or jetstream, got %q", c.NATS.Mode)
+	check(c.NATS.Mode != "jetstream" || c.NATS.Durable != "", "nats.durable: required in jetstream mode")
+	check(c.Worker.BatchSize > 0, "worker.batch_size: must be positive")
+	check(c.Worker.FlushInterval > 0, "worker.flush_interval: must be positive")
+	check(c.Worker.RetryAttempts > 0, "worker.retry_attempts: must be positive")
+	check(c.Outbox.BatchSize > 0, "outbox.batch_size: must be positive")
+	check(c.Outbox.Interval > 0, "outbox.interval: must be positive")
+	check(c.Health.Timeout > 0, "health.timeout: must be positive")
+	check(c.Health.RedisInterval > 0, "health.redis_interval: must be positive")
+	switch c.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	case "file":
+		check(c.Tracing.File != "", "tracing.file: required for file exporter")
+	default:
+		check(false, "tracing.exporter: expected none, stdout, file or otlp, got %q", c.Tracing.Exporter)
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio: must be between 0 and 1")
+	if c.Auth.Mode != "none" {
+		for _, mode := range strings.Split(c.Auth.Mode, ",") {
+			mode = strings.TrimSpace(mode)
+			check(mode == "apikey" || mode == "jwt", "auth.mode: unknown mode %q", mode)
+			check(mode != "jwt" || c.Auth.JWTKeys != "", "auth.jwt_keys: required for jwt auth")
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate - проверяет настройки clickhouse, их же проверяет мигратор.
+func (c ClickHouse) Validate() error {
+	var errs []error
+	if c.Addr == "" {
+		errs = append(errs, errors.New("clickhouse.addr: required"))
+	}
+	if c.Database == "" {
+		errs = append(errs, errors.New("clickhouse.database: required"))
+	}
+	return errors.Join(errs...)
+}
+
+// Load - читает настройки из файла -config (или CONFIG), окружения и флагов args и проверяет их.
+// Аргументы после флагов возвращаются в rest. Если передан -print-config, настройки
+// печатаются в stdout и printed = true.
+func Load(name string, args []string) (cfg Config, rest []string, printed bool, err error) {
+	cfg, rest, printed, err = Parse(name, args, nil)
+	if err != nil || printed {
+		return cfg, rest, printed, err
+	}
+	return cfg, rest, false, cfg.Validate()
+}
+
+// Removed - флаги, которые утилита больше не принимает, и чем их заменить.
+type Removed map[string]string
+
+// Parse - читает настройки как Load, но не проверяет их, для утилит, которым нужна только часть настроек.
+// Флаги из removed возвращают ошибку с подсказкой, даже если это флаги общих настроек.
+func Parse(name string, args []string, removed Removed) (cfg Config, rest []string, printed bool, err error) {
+	cfg = Default()
+	fields := leafFields(reflect.ValueOf(&cfg).Elem())
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	path := fs.String("config", os.Getenv("CONFIG"), "yaml файл с настройками")
+	printConfig := fs.Bool("print-config", false, "напечатать итоговые настройки без секретов и выйти")
+	for _, f := range fields {
+		fs.String(f.flag, f.String(), f.usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, nil, false, err
+	}
+
+	if *path != "" {
+		data, err := os.ReadFile(*path)
+		if err != nil {
+			return cfg, nil, false, err
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return cfg, nil, false, fmt.Errorf("%s: %w", *path, err)
+		}
+	}
+	for _, f := range fields {
+		if v, ok := os.LookupEnv(f.env); ok && f.env != "" {
+			if err := f.Set(v); err != nil {
+				return cfg, nil, false, fmt.Errorf("env %s: %w", f.env, err)
+			}
+		}
+	}
+	byFlag := make(map[string]field, len(fields))
+	for _, f := range fields {
+		byFlag[f.flag] = f
+	}
+	fs.Visit(func(fl *flag.Flag) {
+		if hint, ok := removed[fl.Name]; ok && err == nil {
+			err = fmt.Errorf("flag -%s is not supported, %s", fl.Name, hint)
+		}
+		f, ok := byFlag[fl.Name]
+		if !ok || err != nil {
+			return
+		}
+		if setErr := f.Set(fl.Value.String()); setErr != nil {
+			err = fmt.Errorf("flag -%s: %w", fl.Name, setErr)
+		}
+	})
+	if err != nil {
+		return cfg, nil, false, err
+	}
+
+	if *printConfig {
+		return cfg, fs.Args(), true, cfg.Print(os.Stdout)
+	}
+	return cfg, fs.Args(), false, nil
+}
+
+// Print - пишет настройки в yaml, секреты заменяются на ***.
+func (c Config) Print(w io.Writer) error {
+	redacted := c
+	for _, f := range leafFields(reflect.ValueOf(&redacted).Elem()) {
+		if f.secret && f.value.String() != "" {
+			f.value.SetString("***")
+		}
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(redacted); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// field - настройка, которую можно задать переменной окружения и флагом.
+type field struct {
+	value  reflect.Value
+	flag   string
+	env    string
+	usage  string
+	secret bool
+}
+
+func leafFields(v reflect.Value) []field {
+	var fields []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf, fv := t.Field(i), v.Field(i)
+		if sf.Type.Kind() == reflect.Struct {
+			fields = append(fields, leafFields(fv)...)
+			continue
+		}
+		fields = append(fields, field{
+			value:  fv,
+			flag:   sf.Tag.Get("flag"),
+			env:    sf.Tag.Get("env"),
+			usage:  sf.Tag.Get("usage"),
+			secret: sf.Tag.Get("secret") == "true",
+		})
+	}
+	return fields
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func (f field) String() string {
+	if f.value.Type() == durationType {
+		return time.Duration(f.value.Int()).String()
+	}
+	return fmt.Sprint(f.value.Interface())
+}
+
+func (f field) Set(s string) error {
+	switch {
+	case f.value.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		f.value.SetInt(int64(d))
+	case f.value.Kind() == reflect.String:
+		f.value.SetString(s)
+	case f.value.Kind() == reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		f.value.SetInt(int64(n))
+	case f.value.Kind() == reflect.Float64:
+		x, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		f.value.SetFloat(x)
+	case f.value.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.value.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported type %s", f.value.Type())
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+-- Создание ключа.
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (name, key_hash, is_admin) VALUES (@name, @key_hash, @is_admin) RETURNING *;
+
+-- Выдача ключу доступа к проекту, повторная выдача меняет scope.
+-- name: SetAPIKeyProject :exec
+INSERT INTO api_key_projects (api_key_id, project_id, scope) VALUES (@api_key_id, @project_id, @scope)
+ON CONFLICT (api_key_id, project_id) DO UPDATE SET scope = EXCLUDED.scope;
+
+-- Получение действующего ключа по хешу.
+-- name: GetAPIKeyByHash :one
+SELECT * FROM api_keys WHERE key_hash = @key_hash AND revoked_at IS NULL;
+
+-- Проекты ключа.
+-- name: ListAPIKeyProjects :many
+SELECT project_id, scope FROM api_key_projects WHERE api_key_id = @api_key_id;
+
+-- Отзыв ключа.
+-- name: RevokeAPIKey :one
+UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE id = @id AND revoked_at IS NULL RETURNING *;
+
+-- Список всех ключей.
+-- name: ListAPIKeys :many
+SELECT * FROM api_keys ORDER BY id;
@@ -14,21 +14,75 @@ RETURNING *;
 -- name: UpdateGoodRemoved :one
 UPDATE goods SET removed = @removed WHERE id = @id AND project_id = @project_id RETURNING *;
 
--- Список всех товаров.
+-- Получение товара.
+-- name: GetGood :one
+SELECT * FROM goods WHERE id = @id AND project_id = @project_id;
+
+-- Фильтры списка товаров (одинаковые для ListGoods, ListGoodsAfter и MetaGood):
+--   project_id - если не передан, то по всем проектам;
+--   removed_filter - include (все), exclude (без удаленных), only (только удаленные);
+--   name - шаблон для ILIKE, экранирование и % ставятся на стороне приложения;
+--   created_from, created_to - полуинтервал [created_from, created_to).
+
+-- Список товаров, sort_by - id, priority, name или created_at.
 -- name: ListGoods :many
 SELECT * FROM goods
+WHERE (sqlc.narg(project_id)::int IS NULL OR project_id = sqlc.narg(project_id)::int)
+    AND (@removed_filter::text = 'include' OR removed = (@removed_filter::text = 'only'))
+    AND (sqlc.narg(name)::text IS NULL OR name ILIKE sqlc.narg(name)::text)
+    AND (sqlc.narg(created_from)::timestamptz IS NULL OR created_at >= sqlc.narg(created_from)::timestamptz)
+    AND (sqlc.narg(created_to)::timestamptz IS NULL OR created_at < sqlc.narg(created_to)::timestamptz)
+ORDER BY
+    CASE WHEN @sort_by::text = 'priority' AND NOT @sort_desc::bool THEN priority END,
+    CASE WHEN @sort_by::text = 'priority' AND @sort_desc::bool THEN priority END DESC,
+    CASE WHEN @sort_by::text = 'name' AND NOT @sort_desc::bool THEN name END,
+    CASE WHEN @sort_by::text = 'name' AND @sort_desc::bool THEN name END DESC,
+    CASE WHEN @sort_by::text = 'created_at' AND NOT @sort_desc::bool THEN created_at END,
+    CASE WHEN @sort_by::text = 'created_at' AND @sort_desc::bool THEN created_at END DESC,
+    CASE WHEN @sort_desc::bool THEN id END DESC,
+    id
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- Список товаров после товара с id = after_id (keyset пагинация), всегда по возрастанию id.
+-- name: ListGoodsAfter :many
+SELECT * FROM goods
+WHERE (sqlc.narg(project_id)::int IS NULL OR project_id = sqlc.narg(project_id)::int)
+    AND (@removed_filter::text = 'include' OR removed = (@removed_filter::text = 'only'))
+    AND (sqlc.narg(name)::text IS NULL OR name ILIKE sqlc.narg(name)::text)
+    AND (sqlc.narg(created_from)::timestamptz IS NULL OR created_at >= sqlc.narg(created_from)::timestamptz)
+    AND (sqlc.narg(created_to)::timestamptz IS NULL OR created_at < sqlc.narg(created_to)::timestamptz)
+    AND id > @after_id
 ORDER BY id
-LIMIT $1 OFFSET $2;
+LIMIT sqlc.arg('limit');
 
 -- Метаданные в частности, кол-во записей и кол-во удаленных записей.
 -- name: MetaGood :one
-SELECT Count(*)::int as total, Count(*) FILTER(WHERE removed = TRUE)::int as removed FROM goods;
+SELECT Count(*)::int as total, Count(*) FILTER(WHERE removed = TRUE)::int as removed FROM goods
+WHERE (sqlc.narg(project_id)::int IS NULL OR project_id = sqlc.narg(project_id)::int)
+    AND (@removed_filter::text = 'include' OR removed = (@removed_filter::text = 'only'))
+    AND (sqlc.narg(name)::text IS NULL OR name ILIKE sqlc.narg(name)::text)
+    AND (sqlc.narg(created_from)::timestamptz IS NULL OR created_at >= sqlc.narg(created_from)::timestamptz)
+    AND (sqlc.narg(created_to)::timestamptz IS NULL OR created_at < sqlc.narg(created_to)::timestamptz);
 
--- Существует ли товар.
+-- Блокирует товар до конца транзакции и возвращает его версию.
+-- name: LockGood :one
+SELECT version FROM goods WHERE id = @id AND project_id = @project_id FOR UPDATE;
+
+-- Существует ли товар с заданным статусом удаления.
 -- name: HasGood :one
-SELECT EXISTS (SELECT 1 FROM goods WHERE id = @id AND project_id = @project_id AND removed = FALSE LIMIT 1);
+SELECT EXISTS (SELECT 1 FROM goods WHERE id = @id AND project_id = @project_id AND removed = @removed LIMIT 1);
+
+-- Физическое удаление помеченных удаленными товаров проекта, если id не передан, то всех.
+-- name: PurgeGoods :many
+DELETE FROM goods
+WHERE project_id = @project_id AND removed = TRUE AND (sqlc.narg(id)::int IS NULL OR id = sqlc.narg(id)::int)
+RETURNING *;
+
+-- Физическое удаление всех товаров проекта перед удалением самого проекта.
+-- name: DeleteProjectGoods :many
+DELETE FROM goods WHERE project_id = @project_id RETURNING *;
 
--- Пересчет преоритетов товара.
+-- Пересчет преоритетов товара, сдвигаются только товары того же проекта.
 -- name: ReprioritiizeGood :many
 WITH old AS (SELECT priority FROM goods where id = @id AND goods.project_id = @project_id)
 UPDATE goods SET priority =
@@ -37,4 +91,4 @@ UPDATE goods SET priority =
         WHEN goods.id <> @id AND ((select priority from old) >= @priority AND priority >= @priority AND priority < (select priority from old)) OR ((select priority from old) < @priority AND priority >= @priority) THEN priority+1
         ELSE priority
     END
-WHERE goods.id = @id OR (goods.id <> @id  AND (select priority from old) >= @priority AND priority >= @priority AND priority < (select priority from old) OR ((select priority from old) < @priority AND priority >= @priority)) RETURNING *;
+WHERE goods.project_id = @project_id AND (goods.id = @id OR (goods.id <> @id  AND (select priority from old) >= @priority AND priority >= @priority AND priority < (select priority from old) OR ((select priority from old) < @priority AND priority >= @priority))) RETURNING *;
@@ -0,0 +1,19 @@
+-- Добавление события в outbox.
+-- name: CreateOutboxEvent :exec
+INSERT INTO outbox_events (subject, payload, headers) VALUES (@subject, @payload, @headers);
+
+-- Неотправленные события по порядку, заблокированные другими relay пропускаются.
+-- name: ListPendingOutboxEvents :many
+SELECT * FROM outbox_events WHERE sent_at IS NULL ORDER BY id LIMIT sqlc.arg('limit') FOR UPDATE SKIP LOCKED;
+
+-- Отметка об отправке событий.
+-- name: MarkOutboxEventsSent :exec
+UPDATE outbox_events SET sent_at = CURRENT_TIMESTAMP, attempts = attempts + 1 WHERE id = ANY(@ids::bigint[]);
+
+-- Неудачная попытка отправки.
+-- name: MarkOutboxEventFailed :exec
+UPDATE outbox_events SET attempts = attempts + 1, last_error = @last_error WHERE id = @id;
+
+-- Удаление давно отправленных событий.
+-- name: DeleteSentOutboxEvents :execrows
+DELETE FROM outbox_events WHERE sent_at < @sent_before;
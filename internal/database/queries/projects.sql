@@ -0,0 +1,33 @@
+-- Создание проекта.
+-- name: CreateProject :one
+INSERT INTO projects (name) VALUES (@name) RETURNING *;
+
+-- Обновление проекта.
+-- name: UpdateProject :one
+UPDATE projects SET name = @name WHERE id = @id RETURNING *;
+
+-- Удаление проекта, товары удаляются каскадно.
+-- name: DeleteProject :one
+DELETE FROM projects WHERE id = @id RETURNING *;
+
+-- Блокирует проект до конца транзакции, новые товары в нем не создаются.
+-- name: LockProject :one
+SELECT id FROM projects WHERE id = @id FOR UPDATE;
+
+-- Получение проекта.
+-- name: GetProject :one
+SELECT * FROM projects WHERE id = @id;
+
+-- Список всех проектов.
+-- name: ListProjects :many
+SELECT * FROM projects
+ORDER BY id
+LIMIT $1 OFFSET $2;
+
+-- Кол-во проектов.
+-- name: MetaProject :one
+SELECT Count(*)::int as total FROM projects;
+
+-- Существует ли проект.
+-- name: HasProject :one
+SELECT EXISTS (SELECT 1 FROM projects WHERE id = @id LIMIT 1);
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yudgxe/hezzl-test/internal/apperrors"
+	"github.com/yudgxe/hezzl-test/internal/auth"
+)
+
+const (
+	principalKey = "principal"
+	// subjectKey - идентификатор клиента в контексте, для логов.
+	subjectKey = "subject"
+)
+
+// authMiddleware - аутентифицирует клиента и кладет его в контекст, если аутентификация выключена, то пропускает всех.
+func (e *RouterEnv) authMiddleware(g *gin.Context) {
+	if e.config.Auth == nil {
+		g.Next()
+		return
+	}
+	principal, err := e.config.Auth.Authenticate(g, g.Request)
+	if err != nil {
+		if errors.Is(err, auth.ErrUnauthenticated) {
+			e.logger.Debug().Err(err).Str("path", g.FullPath()).Msg("unauthenticated")
+			handleError(g, apperrors.ErrUnauthorized)
+			return
+		}
+		handleError(g, err)
+		return
+	}
+	g.Set(principalKey, principal)
+	g.Set(subjectKey, principal.Subject)
+	g.Next()
+}
+
+// principal - клиент запроса, nil если аутентификация выключена.
+func principal(g *gin.Context) *auth.Principal {
+	if v, ok := g.Get(principalKey); ok {
+		return v.(*auth.Principal)
+	}
+	return nil
+}
+
+// authorize - проверяет доступ клиента к проекту, при его отсутствии пишет 403 в ответ и возвращает false.
+func authorize(g *gin.Context, projectID int32, scope auth.Scope) bool {
+	p := principal(g)
+	if p == nil || p.Can(projectID, scope) {
+		return true
+	}
+	handleError(g, apperrors.ErrProjectForbidden.WithDetails(map[string]interface{}{
+		"project_id": projectID,
+		"scope":      scope,
+	}))
+	return false
+}
+
+// isAdmin - true если аутентификация выключена или клиент администратор.
+func isAdmin(g *gin.Context) bool {
+	p := principal(g)
+	return p == nil || p.Admin
+}
+
+// requireAdmin - пропускает только администраторов.
+func requireAdmin(g *gin.Context) {
+	if !isAdmin(g) {
+		handleError(g, apperrors.ErrForbidden)
+		return
+	}
+	g.Next()
+}
+
+// methodScope - read для чтения, write для остальных методов.
+func methodScope(g *gin.Context) auth.Scope {
+	if g.Request.Method == http.MethodGet || g.Request.Method == http.MethodHead {
+		return auth.ScopeRead
+	}
+	return auth.ScopeWrite
+}
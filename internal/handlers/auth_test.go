@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/yudgxe/hezzl-test/internal/apperrors"
+	"github.com/yudgxe/hezzl-test/internal/auth"
+	"github.com/yudgxe/hezzl-test/internal/database/sqlc"
+)
+
+func TestAPIKeyAccess(t *testing.T) {
+	good := sqlc.Good{ID: 1, ProjectID: 1, Name: "good", Version: 1}
+	db := newFakeDB(map[string]fakeQuery{
+		"GetAPIKeyByHash": func(args []interface{}) ([][]interface{}, error) {
+			if args[0] != auth.HashAPIKey("hz_reader") {
+				return nil, nil
+			}
+			return [][]interface{}{columns(sqlc.ApiKey{ID: 1})}, nil
+		},
+		"ListAPIKeyProjects": returns(sqlc.ListAPIKeyProjectsRow{ProjectID: 1, Scope: string(auth.ScopeRead)}),
+		"HasGood":            returns(struct{ Exists bool }{true}),
+		"GetGood":            returns(good),
+	})
+	cache, _ := newTestCache(t)
+	r := newTestRouter(db, cache, Config{Auth: auth.NewAPIKeyAuthenticator(sqlc.New(db))})
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		key    string
+		status int
+		err    *apperrors.Error
+	}{
+		{name: "read own project", method: http.MethodGet, target: "/api/v1/good/get?id=1&project_id=1", key: "hz_reader", status: http.StatusOK},
+		{name: "update own project", method: http.MethodPatch, target: "/api/v1/good/update?id=1&project_id=1", key: "hz_reader", status: http.StatusForbidden, err: apperrors.ErrProjectForbidden},
+		{name: "read other project", method: http.MethodGet, target: "/api/v1/good/get?id=1&project_id=2", key: "hz_reader", status: http.StatusForbidden, err: apperrors.ErrProjectForbidden},
+		{name: "update other project", method: http.MethodPatch, target: "/api/v1/good/update?id=1&project_id=2", key: "hz_reader", status: http.StatusForbidden, err: apperrors.ErrProjectForbidden},
+		{name: "unknown key", method: http.MethodGet, target: "/api/v1/good/get?id=1&project_id=1", key: "hz_unknown", status: http.StatusUnauthorized, err: apperrors.ErrUnauthorized},
+		{name: "no key", method: http.MethodGet, target: "/api/v1/good/get?id=1&project_id=1", status: http.StatusUnauthorized, err: apperrors.ErrUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.key != "" {
+				header.Set(auth.APIKeyHeader, tt.key)
+			}
+			w := serve(r, tt.method, tt.target, "10.0.0.1:1000", header)
+			if w.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, w.Code, w.Body)
+			}
+			if tt.err == nil {
+				return
+			}
+			var body WebError
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Code != tt.err.Code {
+				t.Errorf("expected code %d, got %d: %s", tt.err.Code, body.Code, w.Body)
+			}
+		})
+	}
+	for _, call := range db.Calls() {
+		if call == "UpdateGood" {
+			t.Errorf("expected no update with a read key, got calls %v", db.Calls())
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// fakeQuery - ответ на запрос sqlc: строки, каждая строка - значения колонок по порядку.
+type fakeQuery func(args []interface{}) ([][]interface{}, error)
+
+// fakeDB - база для тестов хендлеров, отвечает на запросы sqlc по имени из комментария "-- name: X".
+type fakeDB struct {
+	mu      sync.Mutex
+	queries map[string]fakeQuery
+	calls   []string
+	commits int
+}
+
+func newFakeDB(queries map[string]fakeQuery) *fakeDB {
+	return &fakeDB{queries: queries}
+}
+
+// columns - значения полей структуры в порядке объявления, sqlc сканирует RETURNING * в том же порядке.
+func columns(v interface{}) []interface{} {
+	rv := reflect.ValueOf(v)
+	values := make([]interface{}, rv.NumField())
+	for i := range values {
+		values[i] = rv.Field(i).Interface()
+	}
+	return values
+}
+
+// returns - запрос, который возвращает заданные строки.
+func returns(rows ...interface{}) fakeQuery {
+	return func([]interface{}) ([][]interface{}, error) {
+		result := make([][]interface{}, 0, len(rows))
+		for _, row := range rows {
+			result = append(result, columns(row))
+		}
+		return result, nil
+	}
+}
+
+// Calls - имена выполненных запросов по порядку.
+func (db *fakeDB) Calls() []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]string(nil), db.calls...)
+}
+
+// Commits - количество подтвержденных транзакций.
+func (db *fakeDB) Commits() int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.commits
+}
+
+func (db *fakeDB) run(sql string, args []interface{}) ([][]interface{}, error) {
+	name := strings.TrimSpace(sql)
+	if rest, ok := strings.CutPrefix(name, "-- name: "); ok {
+		name, _, _ = strings.Cut(rest, " ")
+	}
+	db.mu.Lock()
+	db.calls = append(db.calls, name)
+	query, ok := db.queries[name]
+	db.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unexpected query %s", name)
+	}
+	return query(args)
+}
+
+func (db *fakeDB) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	_, err := db.run(sql, args)
+	return nil, err
+}
+
+func (db *fakeDB) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	rows, err := db.run(sql, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{rows: rows, pos: -1}, nil
+}
+
+func (db *fakeDB) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	rows, err := db.run(sql, args)
+	if err == nil && len(rows) == 0 {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		return fakeRow{err: err}
+	}
+	return fakeRow{values: rows[0]}
+}
+
+func (db *fakeDB) Begin(ctx context.Context) (pgx.Tx, error) {
+	return &fakeTx{db: db}, nil
+}
+
+// fakeTx - транзакция, запросы выполняются в той же fakeDB.
+type fakeTx struct {
+	pgx.Tx
+	db *fakeDB
+}
+
+func (tx *fakeTx) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	return tx.db.Exec(ctx, sql, args...)
+}
+
+func (tx *fakeTx) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	return tx.db.Query(ctx, sql, args...)
+}
+
+func (tx *fakeTx) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	return tx.db.QueryRow(ctx, sql, args...)
+}
+
+func (tx *fakeTx) Commit(ctx context.Context) error {
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+	tx.db.commits++
+	return nil
+}
+
+func (tx *fakeTx) Rollback(ctx context.Context) error { return nil }
+
+type fakeRow struct {
+	values []interface{}
+	err    error
+}
+
+func (r fakeRow) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	return scan(r.values, dest)
+}
+
+type fakeRows struct {
+	pgx.Rows
+	rows [][]interface{}
+	pos  int
+}
+
+func (r *fakeRows) Next() bool {
+	r.pos++
+	return r.pos < len(r.rows)
+}
+
+func (r *fakeRows) Scan(dest ...interface{}) error { return scan(r.rows[r.pos], dest) }
+func (r *fakeRows) Close()                         {}
+func (r *fakeRows) Err() error                     { return nil }
+
+func scan(values []interface{}, dest []interface{}) error {
+	if len(values) != len(dest) {
+		return fmt.Errorf("scan: %d values into %d destinations", len(values), len(dest))
+	}
+	for i, v := range values {
+		reflect.ValueOf(dest[i]).Elem().Set(reflect.ValueOf(v))
+	}
+	return nil
+}
@@ -2,13 +2,19 @@ package handlers
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4"
 	"github.com/redis/go-redis/v9"
+	"github.com/yudgxe/hezzl-test/internal/apperrors"
+	"github.com/yudgxe/hezzl-test/internal/auth"
 	"github.com/yudgxe/hezzl-test/internal/database/sqlc"
 	"github.com/yudgxe/hezzl-test/internal/model/clickhouse"
 	"github.com/yudgxe/hezzl-test/internal/tools"
@@ -19,26 +25,39 @@ const goodSubj = "logs.good"
 
 // GoodMiddleware - парсит с url project_id и id, а так же проверяет существование записи.
 func (e *RouterEnv) goodMiddleware(g *gin.Context) {
+	e.checkGood(g, false)
+}
+
+// RemovedGoodMiddleware - то же, что и goodMiddleware, но для товаров помеченных удаленными.
+func (e *RouterEnv) removedGoodMiddleware(g *gin.Context) {
+	e.checkGood(g, true)
+}
+
+func (e *RouterEnv) checkGood(g *gin.Context, removed bool) {
 	goodID, err := strconv.ParseInt(g.Query("id"), 10, 32)
 	if err != nil {
-		g.AbortWithStatusJSON(http.StatusBadRequest, WebError{Code: 0, Message: err.Error()})
+		handleError(g, apperrors.Field("id", err))
 		return
 	}
 	projectID, err := strconv.ParseInt(g.Query("project_id"), 10, 32)
 	if err != nil {
-		g.AbortWithStatusJSON(http.StatusBadRequest, WebError{Code: 0, Message: err.Error()})
+		handleError(g, apperrors.Field("project_id", err))
+		return
+	}
+	if !authorize(g, int32(projectID), methodScope(g)) {
 		return
 	}
 	exist, err := e.sql().HasGood(g, sqlc.HasGoodParams{
 		ID:        int32(goodID),
 		ProjectID: int32(projectID),
+		Removed:   removed,
 	})
 	if err != nil {
-		g.AbortWithStatusJSON(http.StatusBadRequest, WebError{Code: 1, Message: err.Error()})
+		handleError(g, err)
 		return
 	}
 	if !exist {
-		g.AbortWithStatusJSON(http.StatusNotFound, WebError{Code: 3, Message: "errors.good.notFound"})
+		handleError(g, apperrors.ErrGoodNotFound)
 		return
 	}
 
@@ -47,6 +66,26 @@ func (e *RouterEnv) goodMiddleware(g *gin.Context) {
 	g.Next()
 }
 
+// checkIfMatch - если передан If-Match, блокирует товар до конца транзакции q и сравнивает его версию,
+// при несовпадении пишет 412 в ответ и возвращает false.
+func (e *RouterEnv) checkIfMatch(g *gin.Context, q *sqlc.Queries, goodID, projectID int32) bool {
+	header := g.GetHeader("If-Match")
+	if header == "" {
+		return true
+	}
+	version, err := q.LockGood(g, sqlc.LockGoodParams{ID: goodID, ProjectID: projectID})
+	if err != nil {
+		handleError(g, err)
+		return false
+	}
+	if !ifMatch(header, version) {
+		setETag(g, version)
+		handleError(g, apperrors.ErrVersionMismatch)
+		return false
+	}
+	return true
+}
+
 type goodCreateBody struct {
 	Name string `json:"name" binding:"required" example:"name"`
 }
@@ -54,27 +93,45 @@ type goodCreateBody struct {
 // @Summary				Create good
 // @Param               project_id query int true "Project id"
 // @Param request       body goodCreateBody{} true "query params"
+// @Param               Idempotency-Key header string false "Repeated request with the same key returns the original response"
 // @Description			Create good.
 // @Produce				application/json
 // @Tags				goods
+// @Security			ApiKeyAuth
+// @Security			BearerAuth
 // @Router              /good/create [post]
 func (e *RouterEnv) goodCreate(g *gin.Context) {
 	projectID, err := strconv.ParseInt(g.Query("project_id"), 10, 32)
 	if err != nil {
-		g.JSON(http.StatusBadRequest, WebError{Code: 0, Message: err.Error()})
+		handleError(g, apperrors.Field("project_id", err))
+		return
+	}
+	if !authorize(g, int32(projectID), auth.ScopeWrite) {
 		return
 	}
 	var body goodCreateBody
 	if ok := bindAndValidate(g, &body); !ok {
 		return
 	}
-	good, err := e.sql().CreateGood(g, sqlc.CreateGoodParams{Name: body.Name, ProjectID: int32(projectID)})
+
+	idempotencyKey, hash := g.GetHeader("Idempotency-Key"), requestHash(projectID, body)
+	scope := idempotencyScope(g, goodCreateIdempotencyScope)
+	if idempotencyKey != "" {
+		if ok := e.reserveIdempotencyKey(g, scope, idempotencyKey, hash); !ok {
+			return
+		}
+	}
+
+	good, err := e.createGood(g, eventMeta(g), sqlc.CreateGoodParams{Name: body.Name, ProjectID: int32(projectID)})
 	if err != nil {
-		g.JSON(http.StatusInternalServerError, WebError{Code: 1, Message: err.Error()})
+		e.releaseIdempotencyKey(g, scope, idempotencyKey)
+		handleError(g, err)
 		return
 	}
 	e.logger.Info().Interface("good", good).Msg("created good")
+	setETag(g, good.Version)
 	g.JSON(http.StatusCreated, good)
+	e.saveIdempotentResponse(g, scope, idempotencyKey, hash, http.StatusCreated, good)
 }
 
 type goodUpdateBody struct {
@@ -86,9 +143,12 @@ type goodUpdateBody struct {
 // @Param               id query int true "Good id"
 // @Param               project_id query int true "Project id"
 // @Param request       body goodUpdateBody{} true "query params"
+// @Param               If-Match header string false "ETag of the good, 412 if the good has changed"
 // @Description			Update good.
 // @Produce				application/json
 // @Tags				goods
+// @Security			ApiKeyAuth
+// @Security			BearerAuth
 // @Router              /good/update [PATCH]
 func (e *RouterEnv) goodUpdate(g *gin.Context) {
 	goodID := g.MustGet("good_id").(int32)
@@ -97,47 +157,85 @@ func (e *RouterEnv) goodUpdate(g *gin.Context) {
 	if ok := bindAndValidate(g, &body); !ok {
 		return
 	}
-	good, err := e.sql().UpdateGood(g, sqlc.UpdateGoodParams{
+	tx, err := e.db.Begin(g)
+	if err != nil {
+		handleError(g, err)
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	qtx := e.sql().WithTx(tx)
+	if ok := e.checkIfMatch(g, qtx, goodID, projectID); !ok {
+		return
+	}
+	good, err := qtx.UpdateGood(g, sqlc.UpdateGoodParams{
 		Name:        body.Name,
 		Description: body.Description,
 		ID:          int32(goodID),
 		ProjectID:   int32(projectID),
 	})
 	if err != nil {
-		g.JSON(http.StatusInternalServerError, WebError{Code: 1, Message: err.Error()})
+		handleError(g, err)
 		return
 	}
+	if err := enqueueGoods(g, qtx, eventMeta(g), clickhouse.EventUpdated, good); err != nil {
+		handleError(g, err)
+		return
+	}
+	if err := tx.Commit(g); err != nil {
+		handleError(g, err)
+		return
+	}
+	setETag(g, good.Version)
 	g.JSON(http.StatusOK, good)
 	e.logger.Info().Interface("good", good).Msg("updated")
 	if err := e.cache.SetGood(g, good, redis.KeepTTL, true); err != nil {
 		e.logger.Error().Err(err).Msg("failed to updated cache")
-		return
-	}
-	if err := e.publisher.Publish(goodSubj, clickhouse.FromGoodSQLC(good)); err != nil {
-		e.logger.Error().Err(err).Msg("failed to publish")
-		return
 	}
 }
 
 // @Summary				Delete good
 // @Param               id query int true "Good id"
 // @Param               project_id query int true "Project id"
+// @Param               If-Match header string false "ETag of the good, 412 if the good has changed"
 // @Description			Delete good.
 // @Produce				application/json
 // @Tags				goods
+// @Security			ApiKeyAuth
+// @Security			BearerAuth
 // @Router              /good/remove [DELETE]
 func (e *RouterEnv) goodRemove(g *gin.Context) {
 	goodID := g.MustGet("good_id").(int32)
 	projectID := g.MustGet("project_id").(int32)
-	good, err := e.sql().UpdateGoodRemoved(g, sqlc.UpdateGoodRemovedParams{
+	tx, err := e.db.Begin(g)
+	if err != nil {
+		handleError(g, err)
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	qtx := e.sql().WithTx(tx)
+	if ok := e.checkIfMatch(g, qtx, goodID, projectID); !ok {
+		return
+	}
+	good, err := qtx.UpdateGoodRemoved(g, sqlc.UpdateGoodRemovedParams{
 		Removed:   true,
 		ID:        goodID,
 		ProjectID: projectID,
 	})
 	if err != nil {
-		g.JSON(http.StatusInternalServerError, WebError{Code: 1, Message: err.Error()})
+		handleError(g, err)
 		return
 	}
+	if err := enqueueGoods(g, qtx, eventMeta(g), clickhouse.EventRemoved, good); err != nil {
+		handleError(g, err)
+		return
+	}
+	if err := tx.Commit(g); err != nil {
+		handleError(g, err)
+		return
+	}
+	setETag(g, good.Version)
 	g.JSON(http.StatusOK, map[string]interface{}{
 		"id":         goodID,
 		"project_id": projectID,
@@ -147,33 +245,282 @@ func (e *RouterEnv) goodRemove(g *gin.Context) {
 	if err := e.cache.SetGood(g, good, redis.KeepTTL, true); err != nil {
 		e.logger.Error().Err(err).Msg("failed to update cache")
 	}
-	if err := e.publisher.Publish(goodSubj, clickhouse.FromGoodSQLC(good)); err != nil {
-		e.logger.Error().Err(err).Msg("failed to publish")
+}
+
+// @Summary				Restore good
+// @Param               id query int true "Good id"
+// @Param               project_id query int true "Project id"
+// @Param               If-Match header string false "ETag of the good, 412 if the good has changed"
+// @Description			Restore removed good.
+// @Produce				application/json
+// @Tags				goods
+// @Security			ApiKeyAuth
+// @Security			BearerAuth
+// @Router              /good/restore [PATCH]
+func (e *RouterEnv) goodRestore(g *gin.Context) {
+	goodID := g.MustGet("good_id").(int32)
+	projectID := g.MustGet("project_id").(int32)
+	tx, err := e.db.Begin(g)
+	if err != nil {
+		handleError(g, err)
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	qtx := e.sql().WithTx(tx)
+	if ok := e.checkIfMatch(g, qtx, goodID, projectID); !ok {
+		return
+	}
+	good, err := qtx.UpdateGoodRemoved(g, sqlc.UpdateGoodRemovedParams{
+		Removed:   false,
+		ID:        goodID,
+		ProjectID: projectID,
+	})
+	if err != nil {
+		handleError(g, err)
+		return
+	}
+	if err := enqueueGoods(g, qtx, eventMeta(g), clickhouse.EventRestored, good); err != nil {
+		handleError(g, err)
+		return
+	}
+	if err := tx.Commit(g); err != nil {
+		handleError(g, err)
+		return
+	}
+	setETag(g, good.Version)
+	g.JSON(http.StatusOK, good)
+	e.logger.Info().Interface("good", good).Msg("restored")
+	if err := e.cache.SetGood(g, good, redis.KeepTTL, true); err != nil {
+		e.logger.Error().Err(err).Msg("failed to update cache")
+	}
+}
+
+// @Summary				Purge goods
+// @Param               id query int false "Good id, if not set all removed goods of the project are purged"
+// @Param               project_id query int true "Project id"
+// @Param               X-Admin-Token header string true "Admin token"
+// @Description			Physically delete removed goods.
+// @Produce				application/json
+// @Tags				goods
+// @Security			ApiKeyAuth
+// @Security			BearerAuth
+// @Router              /good/purge [DELETE]
+func (e *RouterEnv) goodPurge(g *gin.Context) {
+	projectID, ok := int32Query(g, "project_id")
+	if !ok {
+		return
+	}
+	var goodID sql.NullInt32
+	if g.Query("id") != "" {
+		id, ok := int32Query(g, "id")
+		if !ok {
+			return
+		}
+		goodID = sql.NullInt32{Int32: id, Valid: true}
+	}
+	tx, err := e.db.Begin(g)
+	if err != nil {
+		handleError(g, err)
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	qtx := e.sql().WithTx(tx)
+	purged, err := qtx.PurgeGoods(g, sqlc.PurgeGoodsParams{
+		ProjectID: projectID,
+		ID:        goodID,
+	})
+	if err != nil {
+		handleError(g, err)
+		return
+	}
+	if goodID.Valid && len(purged) == 0 {
+		handleError(g, apperrors.ErrGoodNotFound)
+		return
+	}
+	if err := enqueueGoods(g, qtx, eventMeta(g), clickhouse.EventPurged, purged...); err != nil {
+		handleError(g, err)
+		return
+	}
+	if err := tx.Commit(g); err != nil {
+		handleError(g, err)
+		return
+	}
+	g.JSON(http.StatusOK, map[string]interface{}{
+		"project_id": projectID,
+		"purged":     len(purged),
+	})
+	e.logger.Info().Int32("project_id", projectID).Int("count", len(purged)).Msg("purged")
+	if len(purged) == 0 {
+		return
+	}
+	if err := e.cache.DelGoods(g, purged); err != nil {
+		e.logger.Error().Err(err).Msg("failed to update cache")
+	}
+}
+
+// @Summary				Get good
+// @Param               id query int true "Good id"
+// @Param               project_id query int true "Project id"
+// @Description			Get good.
+// @Produce				application/json
+// @Tags				goods
+// @Security			ApiKeyAuth
+// @Security			BearerAuth
+// @Router              /good/get [GET]
+func (e *RouterEnv) goodGet(g *gin.Context) {
+	goodID := g.MustGet("good_id").(int32)
+	projectID := g.MustGet("project_id").(int32)
+	good, ok, err := e.cache.GetGood(g, goodID, projectID)
+	if err != nil {
+		e.logger.Error().Err(err).Msg("failed to get cache")
+	}
+	if ok {
+		setETag(g, good.Version)
+		g.JSON(http.StatusOK, good)
 		return
 	}
+	good, err = e.sql().GetGood(g, sqlc.GetGoodParams{
+		ID:        goodID,
+		ProjectID: projectID,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			handleError(g, apperrors.ErrGoodNotFound)
+			return
+		}
+		handleError(g, err)
+		return
+	}
+	setETag(g, good.Version)
+	g.JSON(http.StatusOK, good)
+	if err := e.cache.SetGoodWithID(g, good, time.Second*60); err != nil {
+		e.logger.Error().Err(err).Msg("failed to update cash")
+	}
+}
+
+// goodListFilter - фильтры и сортировка списка товаров.
+type goodListFilter struct {
+	Removed     string    `form:"removed" binding:"omitempty,oneof=include exclude only"`
+	Name        string    `form:"name" binding:"omitempty,max=255"`
+	NameMatch   string    `form:"name_match" binding:"omitempty,oneof=contains prefix"`
+	CreatedFrom time.Time `form:"created_from" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedTo   time.Time `form:"created_to" time_format:"2006-01-02T15:04:05Z07:00"`
+	SortBy      string    `form:"sort_by" binding:"omitempty,oneof=id priority name created_at"`
+	Order       string    `form:"order" binding:"omitempty,oneof=asc desc"`
+}
+
+// isDefault - true если фильтры не заданы и сортировка по возрастанию id, только такой список кешируется.
+func (f goodListFilter) isDefault() bool {
+	return (f.Removed == "" || f.Removed == "include") && f.Name == "" && f.CreatedFrom.IsZero() && f.CreatedTo.IsZero() &&
+		(f.SortBy == "" || f.SortBy == "id") && (f.Order == "" || f.Order == "asc")
+}
+
+func (f goodListFilter) metaParams(projectID sql.NullInt32) sqlc.MetaGoodParams {
+	params := sqlc.MetaGoodParams{
+		ProjectID:     projectID,
+		RemovedFilter: tools.Ternary(f.Removed == "", "include", f.Removed),
+		CreatedFrom:   sql.NullTime{Time: f.CreatedFrom, Valid: !f.CreatedFrom.IsZero()},
+		CreatedTo:     sql.NullTime{Time: f.CreatedTo, Valid: !f.CreatedTo.IsZero()},
+	}
+	if f.Name != "" {
+		// Экранируем спецсимволы LIKE, чтобы искать подстроку как есть.
+		pattern := likeEscaper.Replace(f.Name) + "%"
+		if f.NameMatch != "prefix" {
+			pattern = "%" + pattern
+		}
+		params.Name = types.NullString{NullString: sql.NullString{String: pattern, Valid: true}}
+	}
+	return params
 }
 
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
 // @Summary				List goods
 // @Description			List goods.
-// @Param               limit query int true "Limit" default(10)
-// @Param               offset query int true "Offset" default(1)
+// @Param               project_id query int false "Project id, if not set goods of all projects are listed"
+// @Param               limit query int true "Limit" default(10) maximum(100)
+// @Param               offset query int false "Offset" default(1)
+// @Param               cursor query string false "Cursor from next_cursor, pass empty value to get the first page in cursor mode"
+// @Param               removed query string false "Removed goods filter" Enums(include, exclude, only) default(include)
+// @Param               name query string false "Name search"
+// @Param               name_match query string false "Name search mode" Enums(contains, prefix) default(contains)
+// @Param               created_from query string false "Created at from, inclusive (RFC3339)"
+// @Param               created_to query string false "Created at to, exclusive (RFC3339)"
+// @Param               sort_by query string false "Sort field, only id is supported in cursor mode" Enums(id, priority, name, created_at) default(id)
+// @Param               order query string false "Sort order, only asc is supported in cursor mode" Enums(asc, desc) default(asc)
 // @Produce				application/json
 // @Tags				goods
+// @Security			ApiKeyAuth
+// @Security			BearerAuth
 // @Router              /goods/list [GET]
 func (e *RouterEnv) goodList(g *gin.Context) {
-	response, np, err := e.cache.GetGoodsWithPagination(g, tools.GetPagination(g))
+	var projectID sql.NullInt32
+	if g.Query("project_id") != "" {
+		id, ok := int32Query(g, "project_id")
+		if !ok {
+			return
+		}
+		if !authorize(g, id, auth.ScopeRead) {
+			return
+		}
+		projectID = sql.NullInt32{Int32: id, Valid: true}
+	} else if !isAdmin(g) {
+		handleError(g, apperrors.ErrProjectRequired)
+		return
+	}
+
+	var filter goodListFilter
+	if err := g.ShouldBindQuery(&filter); err != nil {
+		handleError(g, apperrors.Validation(err))
+		return
+	}
+
+	cp, ok, err := tools.GetCursorPagination(g)
 	if err != nil {
-		log.Println(err)
+		handleError(g, paginationError(err))
+		return
+	}
+	if ok {
+		if (filter.SortBy != "" && filter.SortBy != "id") || (filter.Order != "" && filter.Order != "asc") {
+			handleError(g, apperrors.ErrCursorSort)
+			return
+		}
+		e.goodListCursor(g, projectID, filter, cp)
+		return
+	}
+
+	p, err := tools.GetPagination(g)
+	if err != nil {
+		handleError(g, paginationError(err))
+		return
+	}
+
+	var response []sqlc.Good
+	var np *tools.GetGoodsWithPaginationReponse
+	if filter.isDefault() {
+		response, np, err = e.cache.GetGoodsWithPagination(g, projectID.Int32, p)
+		if err != nil {
+			log.Println(err)
+		}
+	} else {
+		// Позиции в отфильтрованном списке не совпадают с позициями основного, поэтому кеш не используем.
+		np = tools.NoCacheGoodsWithPagination(p)
 	}
 	if !np.HasNotFound() {
-		pagination := np.Pagination()
-		// TODO: хранить total/removed
+		// Страница целиком из кеша, счетчики все равно берем из базы, как и в режиме курсора.
+		meta, err := e.sql().MetaGood(g, filter.metaParams(projectID))
+		if err != nil {
+			handleError(g, err)
+			return
+		}
 		g.JSON(http.StatusOK, map[string]interface{}{
 			"meta": map[string]interface{}{
-				"total":   0,
-				"removed": 0,
-				"limit":   pagination.Limit,
-				"offset":  pagination.Offset,
+				"total":   meta.Total,
+				"removed": meta.Removed,
+				"limit":   p.Limit,
+				"offset":  p.Offset,
 			},
 			"goods": response,
 		})
@@ -182,51 +529,136 @@ func (e *RouterEnv) goodList(g *gin.Context) {
 	// Оборачиваем в транзакцию, т.к нам важно, чтобы оба запроса работали с одним набором данных.
 	tx, err := e.db.Begin(g)
 	if err != nil {
-		g.JSON(http.StatusInternalServerError, WebError{Code: 1, Message: err.Error()})
+		handleError(g, err)
 		return
 	}
 	defer tx.Rollback(context.Background())
 
 	qtx := e.sql().WithTx(tx)
-	meta, err := qtx.MetaGood(g)
+	mp := filter.metaParams(projectID)
+	meta, err := qtx.MetaGood(g, mp)
 	if err != nil {
-		g.JSON(http.StatusInternalServerError, WebError{Code: 1, Message: err.Error()})
+		handleError(g, err)
 		return
 	}
 
 	pagination := np.Pagination()
 	goods, err := qtx.ListGoods(g, sqlc.ListGoodsParams{
-		Limit:  pagination.Limit,
-		Offset: pagination.Offset,
+		ProjectID:     mp.ProjectID,
+		RemovedFilter: mp.RemovedFilter,
+		Name:          mp.Name,
+		CreatedFrom:   mp.CreatedFrom,
+		CreatedTo:     mp.CreatedTo,
+		SortBy:        tools.Ternary(filter.SortBy == "", "id", filter.SortBy),
+		SortDesc:      filter.Order == "desc",
+		Limit:         pagination.Limit,
+		Offset:        pagination.Offset,
 	})
 	if err != nil {
-		g.JSON(http.StatusInternalServerError, WebError{Code: 1, Message: err.Error()})
+		handleError(g, err)
 		return
 	}
 	if err := tx.Commit(g); err != nil {
-		g.JSON(http.StatusInternalServerError, WebError{Code: 1, Message: err.Error()})
+		handleError(g, err)
 		return
 	}
 	response = tools.MergeSlices(response, goods, np.MergeIndex())
+	// В meta отдаем запрошенную страницу, а не ту часть, которую пришлось дочитать из базы.
 	g.JSON(http.StatusOK, map[string]interface{}{
 		"meta": map[string]interface{}{
 			"total":   meta.Total,
 			"removed": meta.Removed,
-			"limit":   pagination.Limit,
-			"offset":  pagination.Offset,
+			"limit":   p.Limit,
+			"offset":  p.Offset,
 		},
 		"goods": response,
 	})
 
+	if !filter.isDefault() {
+		return
+	}
 	// Обновляем кеш.
 	for i, good := range goods {
-		if err := e.cache.SetGoodWihtPagination(g, good, time.Second*60, false, pagination.Offset+i+1); err != nil {
+		if err := e.cache.SetGoodWihtPagination(g, good, time.Second*60, false, projectID.Int32, pagination.Offset+i+1); err != nil {
 			e.logger.Error().Err(err).Msg("failed to update cash")
 		}
 	}
 
 }
 
+// goodListCursor - список товаров в режиме курсора, страница строится по (id), поэтому
+// вставка новых товаров и смена приоритетов не сдвигает уже выданные страницы.
+func (e *RouterEnv) goodListCursor(g *gin.Context, projectID sql.NullInt32, filter goodListFilter, pagination tools.CursorPagination) {
+	var goods []sqlc.Good
+	var next string
+	var cached bool
+	var err error
+
+	cursor := pagination.Cursor.Encode()
+	if filter.isDefault() {
+		goods, next, cached, err = e.cache.GetGoodsPage(g, projectID.Int32, cursor, pagination.Limit)
+		if err != nil {
+			e.logger.Error().Err(err).Msg("failed to get cache")
+		}
+	}
+
+	tx, err := e.db.Begin(g)
+	if err != nil {
+		handleError(g, err)
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	qtx := e.sql().WithTx(tx)
+	mp := filter.metaParams(projectID)
+	meta, err := qtx.MetaGood(g, mp)
+	if err != nil {
+		handleError(g, err)
+		return
+	}
+	if !cached {
+		// Берем на один товар больше, чтобы понять есть ли следующая страница.
+		goods, err = qtx.ListGoodsAfter(g, sqlc.ListGoodsAfterParams{
+			ProjectID:     mp.ProjectID,
+			RemovedFilter: mp.RemovedFilter,
+			Name:          mp.Name,
+			CreatedFrom:   mp.CreatedFrom,
+			CreatedTo:     mp.CreatedTo,
+			AfterID:       pagination.Cursor.ID,
+			Limit:         pagination.Limit + 1,
+		})
+		if err != nil {
+			handleError(g, err)
+			return
+		}
+		next = ""
+		if len(goods) > pagination.Limit {
+			goods = goods[:pagination.Limit]
+			next = tools.Cursor{ID: goods[len(goods)-1].ID}.Encode()
+		}
+	}
+	if err := tx.Commit(g); err != nil {
+		handleError(g, err)
+		return
+	}
+	g.JSON(http.StatusOK, map[string]interface{}{
+		"meta": map[string]interface{}{
+			"total":       meta.Total,
+			"removed":     meta.Removed,
+			"limit":       pagination.Limit,
+			"next_cursor": next,
+		},
+		"goods": goods,
+	})
+
+	// Последняя страница может дополниться новыми товарами, поэтому в кеш кладем только полные.
+	if !cached && next != "" && filter.isDefault() {
+		if err := e.cache.SetGoodsPage(g, projectID.Int32, cursor, pagination.Limit, goods, next, time.Second*60); err != nil {
+			e.logger.Error().Err(err).Msg("failed to update cash")
+		}
+	}
+}
+
 type goodReprioritiizeBody struct {
 	NewPriority int `json:"new_priority" binding:"required"`
 }
@@ -236,8 +668,11 @@ type goodReprioritiizeBody struct {
 // @Param               id query int true "Good id"
 // @Param               project_id query int true "Project id"
 // @Param request       body goodReprioritiizeBody{} true "query params"
+// @Param               If-Match header string false "ETag of the good, 412 if the good has changed"
 // @Produce				application/json
 // @Tags				goods
+// @Security			ApiKeyAuth
+// @Security			BearerAuth
 // @Router              /good/reprioritiize [PATCH]
 func (e *RouterEnv) goodReprioritiize(g *gin.Context) {
 	goodID := g.MustGet("good_id").(int32)
@@ -248,16 +683,40 @@ func (e *RouterEnv) goodReprioritiize(g *gin.Context) {
 		return
 	}
 
-	updated, err := e.sql().ReprioritiizeGood(g, sqlc.ReprioritiizeGoodParams{
+	tx, err := e.db.Begin(g)
+	if err != nil {
+		handleError(g, err)
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	qtx := e.sql().WithTx(tx)
+	if ok := e.checkIfMatch(g, qtx, goodID, projectID); !ok {
+		return
+	}
+	updated, err := qtx.ReprioritiizeGood(g, sqlc.ReprioritiizeGoodParams{
 		ID:        goodID,
 		ProjectID: projectID,
 		Priority:  int32(body.NewPriority),
 	})
 	if err != nil {
-		g.JSON(http.StatusInternalServerError, WebError{Code: 1, Message: err.Error()})
+		handleError(g, err)
+		return
+	}
+	if err := enqueueGoods(g, qtx, eventMeta(g), clickhouse.EventReprioritized, updated...); err != nil {
+		handleError(g, err)
+		return
+	}
+	if err := tx.Commit(g); err != nil {
+		handleError(g, err)
 		return
 	}
 
+	for _, good := range updated {
+		if good.ID == goodID {
+			setETag(g, good.Version)
+		}
+	}
 	g.JSON(http.StatusOK, updated)
 	for _, good := range updated {
 		if err := e.cache.SetGood(g, good, redis.KeepTTL, true); err != nil {
@@ -271,7 +730,7 @@ func (e *RouterEnv) goodReprioritiize(g *gin.Context) {
 func int32Query(g *gin.Context, key string) (int32, bool) {
 	value, err := strconv.ParseInt(g.Query(key), 10, 32)
 	if err != nil {
-		g.JSON(http.StatusBadRequest, WebError{Code: 0, Message: err.Error()})
+		handleError(g, apperrors.Field(key, err))
 		return 0, false
 	}
 	return int32(value), true
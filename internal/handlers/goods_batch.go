@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4"
+	"github.com/redis/go-redis/v9"
+	"github.com/yudgxe/hezzl-test/internal/apperrors"
+	"github.com/yudgxe/hezzl-test/internal/auth"
+	"github.com/yudgxe/hezzl-test/internal/database/sqlc"
+	"github.com/yudgxe/hezzl-test/internal/model/clickhouse"
+	"github.com/yudgxe/hezzl-test/internal/types"
+)
+
+const goodBatchMaxOperations = 1000
+
+type goodBatchOperation struct {
+	// Op - create, update или remove.
+	Op          string           `json:"op" binding:"required" example:"create"`
+	ID          int32            `json:"id" example:"1"`
+	ProjectID   int32            `json:"project_id" binding:"required" example:"1"`
+	Name        string           `json:"name" example:"name"`
+	Description types.NullString `json:"description" example:"description" swaggertype:"string"`
+	// Version - ожидаемая версия товара для update и remove, аналог If-Match.
+	Version *int32 `json:"version,omitempty" example:"1"`
+}
+
+type goodBatchBody struct {
+	// Partial - выполнять операции по отдельности и вернуть результат каждой,
+	// по умолчанию все операции выполняются в одной транзакции.
+	Partial    bool                 `json:"partial" example:"false"`
+	Operations []goodBatchOperation `json:"operations" binding:"required"`
+}
+
+type goodBatchResult struct {
+	Index int        `json:"index"`
+	Op    string     `json:"op"`
+	Good  *sqlc.Good `json:"good,omitempty"`
+	Error string     `json:"error,omitempty"`
+	Code  int        `json:"code,omitempty"`
+}
+
+// @Summary				Batch goods
+// @Param request       body goodBatchBody{} true "query params"
+// @Description			Create, update and remove goods in one request.
+// @Description			By default all operations run in one transaction, with partial = true every operation runs on its own.
+// @Produce				application/json
+// @Tags				goods
+// @Security			ApiKeyAuth
+// @Security			BearerAuth
+// @Router              /goods/batch [post]
+func (e *RouterEnv) goodBatch(g *gin.Context) {
+	var body goodBatchBody
+	if ok := bindAndValidate(g, &body); !ok {
+		return
+	}
+	if len(body.Operations) == 0 {
+		handleError(g, apperrors.ErrBatchEmpty)
+		return
+	}
+	if len(body.Operations) > goodBatchMaxOperations {
+		handleError(g, apperrors.ErrBatchTooMany)
+		return
+	}
+	// Доступ проверяется до выполнения, чтобы батч не применился частично из-за чужого проекта.
+	for _, op := range body.Operations {
+		if !authorize(g, op.ProjectID, auth.ScopeWrite) {
+			return
+		}
+	}
+
+	results := make([]goodBatchResult, 0, len(body.Operations))
+	if body.Partial {
+		for i, op := range body.Operations {
+			result := goodBatchResult{Index: i, Op: op.Op}
+			good, err := e.applyGoodBatchOperationTx(g, eventMeta(g), op)
+			if err != nil {
+				ae := apperrors.From(err)
+				result.Error, result.Code = ae.Message, ae.Code
+			} else {
+				result.Good = &good
+			}
+			results = append(results, result)
+		}
+	} else {
+		tx, err := e.db.Begin(g)
+		if err != nil {
+			handleError(g, err)
+			return
+		}
+		defer tx.Rollback(context.Background())
+
+		qtx := e.sql().WithTx(tx)
+		for i, op := range body.Operations {
+			good, err := applyGoodBatchOperation(g, qtx, op)
+			if err == nil {
+				err = enqueueGoods(g, qtx, eventMeta(g), goodBatchEventType(op), good)
+			}
+			if err != nil {
+				handleError(g, apperrors.From(err).WithDetails(map[string]interface{}{"index": i}))
+				return
+			}
+			results = append(results, goodBatchResult{Index: i, Op: op.Op, Good: &good})
+		}
+		if err := tx.Commit(g); err != nil {
+			handleError(g, err)
+			return
+		}
+	}
+	g.JSON(http.StatusOK, map[string]interface{}{
+		"results": results,
+	})
+
+	changed := make([]sqlc.Good, 0, len(results))
+	for _, result := range results {
+		if result.Good != nil {
+			changed = append(changed, *result.Good)
+		}
+	}
+	e.logger.Info().Int("count", len(changed)).Msg("batch")
+
+	// Созданные товары в кеше еще не лежат, обновляем только существующие.
+	if err := e.cache.SetGoods(g, changed, redis.KeepTTL, true); err != nil {
+		e.logger.Error().Err(err).Msg("failed to update cache")
+	}
+}
+
+// applyGoodBatchOperationTx - выполняет операцию батча в отдельной транзакции вместе с записью в outbox.
+func (e *RouterEnv) applyGoodBatchOperationTx(ctx context.Context, meta clickhouse.EventMeta, op goodBatchOperation) (sqlc.Good, error) {
+	tx, err := e.db.Begin(ctx)
+	if err != nil {
+		return sqlc.Good{}, err
+	}
+	defer tx.Rollback(context.Background())
+
+	qtx := e.sql().WithTx(tx)
+	good, err := applyGoodBatchOperation(ctx, qtx, op)
+	if err != nil {
+		return good, err
+	}
+	if err := enqueueGoods(ctx, qtx, meta, goodBatchEventType(op), good); err != nil {
+		return good, err
+	}
+	return good, tx.Commit(ctx)
+}
+
+// goodBatchEventType - тип события для операции батча.
+func goodBatchEventType(op goodBatchOperation) clickhouse.EventType {
+	switch op.Op {
+	case "create":
+		return clickhouse.EventCreated
+	case "remove":
+		return clickhouse.EventRemoved
+	default:
+		return clickhouse.EventUpdated
+	}
+}
+
+// applyGoodBatchOperation - выполняет одну операцию батча.
+func applyGoodBatchOperation(ctx context.Context, q *sqlc.Queries, op goodBatchOperation) (sqlc.Good, error) {
+	if op.Op == "create" {
+		if op.Name == "" {
+			return sqlc.Good{}, apperrors.ErrNameRequired
+		}
+		return q.CreateGood(ctx, sqlc.CreateGoodParams{Name: op.Name, ProjectID: op.ProjectID})
+	}
+
+	if op.Op != "update" && op.Op != "remove" {
+		return sqlc.Good{}, apperrors.ErrBatchUnknownOperation
+	}
+	exist, err := q.HasGood(ctx, sqlc.HasGoodParams{ID: op.ID, ProjectID: op.ProjectID})
+	if err != nil {
+		return sqlc.Good{}, err
+	}
+	if !exist {
+		return sqlc.Good{}, apperrors.ErrGoodNotFound
+	}
+	if op.Version != nil {
+		version, err := q.LockGood(ctx, sqlc.LockGoodParams{ID: op.ID, ProjectID: op.ProjectID})
+		if err != nil {
+			return sqlc.Good{}, err
+		}
+		if version != *op.Version {
+			return sqlc.Good{}, apperrors.ErrVersionMismatch
+		}
+	}
+
+	var good sqlc.Good
+	if op.Op == "update" {
+		if op.Name == "" {
+			return sqlc.Good{}, apperrors.ErrNameRequired
+		}
+		good, err = q.UpdateGood(ctx, sqlc.UpdateGoodParams{
+			Name:        op.Name,
+			Description: op.Description,
+			ID:          op.ID,
+			ProjectID:   op.ProjectID,
+		})
+	} else {
+		good, err = q.UpdateGoodRemoved(ctx, sqlc.UpdateGoodRemovedParams{
+			Removed:   true,
+			ID:        op.ID,
+			ProjectID: op.ProjectID,
+		})
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return good, apperrors.ErrGoodNotFound
+	}
+	return good, err
+}
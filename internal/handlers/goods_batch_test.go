@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/yudgxe/hezzl-test/internal/apperrors"
+	"github.com/yudgxe/hezzl-test/internal/database/sqlc"
+)
+
+func TestGoodBatchVersion(t *testing.T) {
+	good := sqlc.Good{ID: 1, ProjectID: 1, Name: "good", Version: 3}
+	tests := []struct {
+		name    string
+		version int32
+		partial bool
+		status  int
+		code    int
+	}{
+		{"current", 3, false, http.StatusOK, 0},
+		{"stale", 2, false, http.StatusPreconditionFailed, apperrors.ErrVersionMismatch.Code},
+		{"stale partial", 2, true, http.StatusOK, apperrors.ErrVersionMismatch.Code},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newFakeDB(map[string]fakeQuery{
+				"HasGood":           returns(struct{ Exists bool }{true}),
+				"LockGood":          returns(struct{ Version int32 }{good.Version}),
+				"UpdateGood":        returns(good),
+				"CreateOutboxEvent": returns(),
+			})
+			cache, _ := newTestCache(t)
+			r := newTestRouter(db, cache, Config{})
+
+			body, _ := json.Marshal(map[string]interface{}{
+				"partial": tt.partial,
+				"operations": []map[string]interface{}{
+					{"op": "update", "id": 1, "project_id": 1, "name": "good", "version": tt.version},
+				},
+			})
+			w := serveBody(r, http.MethodPost, "/api/v1/goods/batch", "10.0.0.1:1000", nil, string(body))
+			if w.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, w.Code, w.Body)
+			}
+			var response struct {
+				Code    int
+				Results []goodBatchResult `json:"results"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			code := response.Code
+			if len(response.Results) == 1 {
+				code = response.Results[0].Code
+			}
+			if code != tt.code {
+				t.Errorf("expected code %d, got %d: %s", tt.code, code, w.Body)
+			}
+			for _, call := range db.Calls() {
+				if call == "UpdateGood" && tt.code != 0 {
+					t.Errorf("expected no update on version mismatch, got %v", db.Calls())
+				}
+			}
+		})
+	}
+}
+
+func TestGoodBatch(t *testing.T) {
+	created := sqlc.Good{ID: 2, ProjectID: 1, Name: "created", Version: 1}
+	newDB := func() *fakeDB {
+		return newFakeDB(map[string]fakeQuery{
+			// Существует только товар с id 1.
+			"HasGood": func(args []interface{}) ([][]interface{}, error) {
+				return [][]interface{}{{args[0].(int32) == 1}}, nil
+			},
+			"CreateGood":        returns(created),
+			"UpdateGood":        returns(sqlc.Good{ID: 1, ProjectID: 1, Name: "updated", Version: 2}),
+			"CreateOutboxEvent": returns(),
+		})
+	}
+	operations := func(ops ...string) []map[string]interface{} {
+		result := make([]map[string]interface{}, 0, len(ops))
+		for _, op := range ops {
+			result = append(result, map[string]interface{}{"op": op, "id": 1, "project_id": 1, "name": "good"})
+		}
+		return result
+	}
+	missing := map[string]interface{}{"op": "update", "id": 5, "project_id": 1, "name": "good"}
+	tooMany := make([]map[string]interface{}, goodBatchMaxOperations+1)
+	for i := range tooMany {
+		tooMany[i] = operations("create")[0]
+	}
+
+	tests := []struct {
+		name       string
+		operations []map[string]interface{}
+		status     int
+		code       int
+		index      int
+	}{
+		{"empty", operations(), http.StatusBadRequest, apperrors.ErrBatchEmpty.Code, -1},
+		{"too many", tooMany, http.StatusBadRequest, apperrors.ErrBatchTooMany.Code, -1},
+		{"unknown operation", operations("create", "move"), http.StatusBadRequest, apperrors.ErrBatchUnknownOperation.Code, 1},
+		{"missing good", append(operations("create"), missing), http.StatusNotFound, apperrors.ErrGoodNotFound.Code, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newDB()
+			cache, _ := newTestCache(t)
+			r := newTestRouter(db, cache, Config{})
+
+			body, _ := json.Marshal(map[string]interface{}{"operations": tt.operations})
+			w := serveBody(r, http.MethodPost, "/api/v1/goods/batch", "10.0.0.1:1000", nil, string(body))
+			if w.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, w.Code, w.Body)
+			}
+			var we struct {
+				Code    int
+				Details struct {
+					Index *int `json:"index"`
+				}
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &we); err != nil {
+				t.Fatal(err)
+			}
+			if we.Code != tt.code {
+				t.Errorf("expected code %d, got %d", tt.code, we.Code)
+			}
+			if tt.index >= 0 && (we.Details.Index == nil || *we.Details.Index != tt.index) {
+				t.Errorf("expected failed operation index %d, got %s", tt.index, w.Body)
+			}
+			// Батч выполняется целиком или не выполняется вовсе.
+			if db.Commits() != 0 {
+				t.Errorf("expected batch to be rolled back, got %d commits", db.Commits())
+			}
+		})
+	}
+
+	t.Run("partial", func(t *testing.T) {
+		db := newDB()
+		cache, _ := newTestCache(t)
+		r := newTestRouter(db, cache, Config{})
+
+		body, _ := json.Marshal(map[string]interface{}{
+			"partial":    true,
+			"operations": append(operations("create", "move"), missing, operations("update")[0]),
+		})
+		w := serveBody(r, http.MethodPost, "/api/v1/goods/batch", "10.0.0.1:1000", nil, string(body))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+		}
+		var response struct {
+			Results []goodBatchResult `json:"results"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		expected := []struct {
+			op   string
+			id   int32
+			code int
+		}{
+			{"create", created.ID, 0},
+			{"move", 0, apperrors.ErrBatchUnknownOperation.Code},
+			{"update", 0, apperrors.ErrGoodNotFound.Code},
+			{"update", 1, 0},
+		}
+		if len(response.Results) != len(expected) {
+			t.Fatalf("expected %d results, got %s", len(expected), w.Body)
+		}
+		for i, e := range expected {
+			result := response.Results[i]
+			if result.Index != i || result.Op != e.op || result.Code != e.code {
+				t.Errorf("result %d: expected %s with code %d, got %+v", i, e.op, e.code, result)
+			}
+			if (result.Good != nil) != (e.code == 0) || (result.Good != nil && result.Good.ID != e.id) {
+				t.Errorf("result %d: expected good %d, got %+v", i, e.id, result.Good)
+			}
+		}
+		// Успешные операции подтверждаются по отдельности.
+		if db.Commits() != 2 {
+			t.Errorf("expected 2 commits, got %d", db.Commits())
+		}
+	})
+}
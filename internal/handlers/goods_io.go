@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4"
+	"github.com/redis/go-redis/v9"
+	"github.com/yudgxe/hezzl-test/internal/apperrors"
+	"github.com/yudgxe/hezzl-test/internal/auth"
+	"github.com/yudgxe/hezzl-test/internal/database/sqlc"
+	"github.com/yudgxe/hezzl-test/internal/model/clickhouse"
+	"github.com/yudgxe/hezzl-test/internal/tools"
+	"github.com/yudgxe/hezzl-test/internal/types"
+)
+
+const (
+	// goodExportChunk - сколько товаров за раз читается из базы при экспорте.
+	goodExportChunk = 500
+	// goodImportMaxLine - максимальная длина строки jsonl при импорте.
+	goodImportMaxLine = 1 << 20
+)
+
+// goodCSVHeader - колонки csv, совпадают с json тегами sqlc.Good.
+var goodCSVHeader = []string{"id", "project_id", "name", "description", "priority", "removed", "created_at"}
+
+// goodImportRow - строка импорта. Описание и статус удаления меняются только если заданы в строке,
+// иначе импорт файла без этих колонок затер бы описания и восстановил удаленные товары.
+type goodImportRow struct {
+	ID          int32   `json:"id"`
+	Name        string  `json:"name"`
+	Description *string `json:"description"`
+	Removed     *bool   `json:"removed"`
+}
+
+func (row goodImportRow) description() types.NullString {
+	if row.Description == nil {
+		return types.NullString{}
+	}
+	return types.NullString{NullString: sql.NullString{String: *row.Description, Valid: true}}
+}
+
+type goodImportError struct {
+	Line    int         `json:"line"`
+	Error   string      `json:"error"`
+	Code    int         `json:"code"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// @Summary				Export goods
+// @Param               project_id query int true "Project id"
+// @Param               format query string false "Format" Enums(csv, jsonl) default(jsonl)
+// @Description			Export all goods of the project.
+// @Produce				text/csv,application/x-ndjson
+// @Tags				goods
+// @Security			ApiKeyAuth
+// @Security			BearerAuth
+// @Router              /goods/export [GET]
+func (e *RouterEnv) goodExport(g *gin.Context) {
+	projectID, ok := int32Query(g, "project_id")
+	if !ok {
+		return
+	}
+	if !authorize(g, projectID, auth.ScopeRead) {
+		return
+	}
+	format := g.DefaultQuery("format", "jsonl")
+	if format != "csv" && format != "jsonl" {
+		handleError(g, apperrors.ErrUnknownFormat)
+		return
+	}
+
+	var write func(good sqlc.Good) error
+	var flush func() error
+	if format == "csv" {
+		w := csv.NewWriter(g.Writer)
+		write = func(good sqlc.Good) error { return w.Write(goodToCSV(good)) }
+		flush = func() error { w.Flush(); return w.Error() }
+		g.Header("Content-Type", "text/csv")
+		if err := w.Write(goodCSVHeader); err != nil {
+			return
+		}
+	} else {
+		enc := json.NewEncoder(g.Writer)
+		write = func(good sqlc.Good) error { return enc.Encode(good) }
+		flush = func() error { return nil }
+		g.Header("Content-Type", "application/x-ndjson")
+	}
+	g.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="goods_%d.%s"`, projectID, format))
+	g.Status(http.StatusOK)
+
+	// Читаем товары кусками по id, чтобы не держать весь проект в памяти.
+	var afterID int32
+	for {
+		goods, err := e.sql().ListGoodsAfter(g, sqlc.ListGoodsAfterParams{
+			ProjectID:     sql.NullInt32{Int32: projectID, Valid: true},
+			RemovedFilter: "include",
+			AfterID:       afterID,
+			Limit:         goodExportChunk,
+		})
+		if err != nil {
+			// Заголовки уже отправлены, остается только оборвать ответ.
+			e.logger.Error().Err(err).Int32("project_id", projectID).Msg("failed to export goods")
+			return
+		}
+		for _, good := range goods {
+			if err := write(good); err != nil {
+				e.logger.Error().Err(err).Msg("failed to write export")
+				return
+			}
+		}
+		if err := flush(); err != nil {
+			e.logger.Error().Err(err).Msg("failed to write export")
+			return
+		}
+		g.Writer.Flush()
+		if len(goods) < goodExportChunk {
+			return
+		}
+		afterID = goods[len(goods)-1].ID
+	}
+}
+
+// @Summary				Import goods
+// @Param               project_id query int true "Project id"
+// @Param               format query string false "Format" Enums(csv, jsonl) default(jsonl)
+// @Param               request body string true "Goods in csv (with header) or jsonl format"
+// @Description			Import goods: rows with id of an existing good of the project update it, other rows create new goods.
+// @Accept				text/csv,application/x-ndjson
+// @Produce				application/json
+// @Tags				goods
+// @Security			ApiKeyAuth
+// @Security			BearerAuth
+// @Router              /goods/import [POST]
+func (e *RouterEnv) goodImport(g *gin.Context) {
+	projectID, ok := int32Query(g, "project_id")
+	if !ok {
+		return
+	}
+	if !authorize(g, projectID, auth.ScopeWrite) {
+		return
+	}
+	format := g.DefaultQuery("format", "jsonl")
+	if format != "csv" && format != "jsonl" {
+		handleError(g, apperrors.ErrUnknownFormat)
+		return
+	}
+
+	var created, updated int
+	rowErrors := make([]goodImportError, 0)
+	changed := make([]sqlc.Good, 0)
+	handle := func(line int, row goodImportRow, err error) {
+		if err == nil {
+			var good sqlc.Good
+			var isNew bool
+			good, isNew, err = e.importGood(g, eventMeta(g), projectID, row)
+			if err == nil {
+				changed = append(changed, good)
+				if isNew {
+					created++
+				} else {
+					updated++
+				}
+				return
+			}
+		}
+		ae := apperrors.From(err)
+		rowErrors = append(rowErrors, goodImportError{Line: line, Error: ae.Message, Code: ae.Code, Details: ae.Details})
+	}
+
+	var err error
+	if format == "csv" {
+		err = readGoodsCSV(g.Request.Body, handle)
+	} else {
+		err = readGoodsJSONL(g.Request.Body, handle)
+	}
+	if err != nil {
+		handleError(g, apperrors.Validation(err).WithDetails(map[string]interface{}{
+			"created": created,
+			"updated": updated,
+			"errors":  rowErrors,
+		}))
+	} else {
+		g.JSON(http.StatusOK, map[string]interface{}{
+			"created": created,
+			"updated": updated,
+			"errors":  rowErrors,
+		})
+	}
+	e.logger.Info().Int32("project_id", projectID).Int("created", created).Int("updated", updated).Int("errors", len(rowErrors)).Msg("imported goods")
+
+	if err := e.cache.SetGoods(g, changed, redis.KeepTTL, true); err != nil {
+		e.logger.Error().Err(err).Msg("failed to update cache")
+	}
+}
+
+// importGood - обновляет товар проекта с id = row.ID, если такого нет, то создает новый.
+func (e *RouterEnv) importGood(ctx context.Context, meta clickhouse.EventMeta, projectID int32, row goodImportRow) (sqlc.Good, bool, error) {
+	if row.Name == "" {
+		return sqlc.Good{}, false, apperrors.ErrNameRequired
+	}
+	if len(row.Name) > 255 {
+		return sqlc.Good{}, false, apperrors.ErrNameTooLong
+	}
+
+	tx, err := e.db.Begin(ctx)
+	if err != nil {
+		return sqlc.Good{}, false, err
+	}
+	defer tx.Rollback(context.Background())
+	qtx := e.sql().WithTx(tx)
+
+	isNew := false
+	// Незаданное описание не меняется, UpdateGood оставляет текущее при NULL.
+	result, err := qtx.UpdateGood(ctx, sqlc.UpdateGoodParams{
+		Name:        row.Name,
+		Description: row.description(),
+		ID:          row.ID,
+		ProjectID:   projectID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		isNew = true
+		result, err = qtx.CreateGood(ctx, sqlc.CreateGoodParams{Name: row.Name, ProjectID: projectID})
+		if err == nil && row.Description != nil {
+			result, err = qtx.UpdateGood(ctx, sqlc.UpdateGoodParams{
+				Name:        result.Name,
+				Description: row.description(),
+				ID:          result.ID,
+				ProjectID:   projectID,
+			})
+		}
+	}
+	if err != nil {
+		return sqlc.Good{}, false, err
+	}
+	if row.Removed != nil && result.Removed != *row.Removed {
+		result, err = qtx.UpdateGoodRemoved(ctx, sqlc.UpdateGoodRemovedParams{
+			Removed:   *row.Removed,
+			ID:        result.ID,
+			ProjectID: projectID,
+		})
+		if err != nil {
+			return sqlc.Good{}, false, err
+		}
+	}
+	if err := enqueueGoods(ctx, qtx, meta, tools.Ternary(isNew, clickhouse.EventCreated, clickhouse.EventUpdated), result); err != nil {
+		return sqlc.Good{}, false, err
+	}
+	return result, isNew, tx.Commit(ctx)
+}
+
+func goodToCSV(good sqlc.Good) []string {
+	return []string{
+		strconv.FormatInt(int64(good.ID), 10),
+		strconv.FormatInt(int64(good.ProjectID), 10),
+		good.Name,
+		good.Description.String,
+		strconv.FormatInt(int64(good.Priority), 10),
+		strconv.FormatBool(good.Removed),
+		good.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// readGoodsCSV - читает товары из csv с заголовком, обязательна только колонка name.
+// Пустые ячейки description и removed считаются незаданными.
+// Ошибки отдельных строк передаются в handle, возвращается только ошибка чтения самого csv.
+func readGoodsCSV(r io.Reader, handle func(line int, row goodImportRow, err error)) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+	if _, ok := columns["name"]; !ok {
+		return apperrors.ErrCSVNameColumn
+	}
+	get := func(record []string, column string) string {
+		if i, ok := columns[column]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			var perr *csv.ParseError
+			if errors.As(err, &perr) && perr.Err == csv.ErrFieldCount {
+				handle(line, goodImportRow{}, apperrors.Validation(err))
+				continue
+			}
+			return err
+		}
+
+		var row goodImportRow
+		row.Name = get(record, "name")
+		if v := get(record, "description"); v != "" {
+			row.Description = &v
+		}
+		if v := get(record, "id"); v != "" {
+			id, err := strconv.ParseInt(v, 10, 32)
+			if err != nil {
+				handle(line, row, apperrors.Field("id", err))
+				continue
+			}
+			row.ID = int32(id)
+		}
+		if v := get(record, "removed"); v != "" {
+			removed, err := strconv.ParseBool(v)
+			if err != nil {
+				handle(line, row, apperrors.Field("removed", err))
+				continue
+			}
+			row.Removed = &removed
+		}
+		handle(line, row, nil)
+	}
+}
+
+// readGoodsJSONL - читает товары в формате экспорта, по одному json на строку.
+// Отсутствующие поля description и removed считаются незаданными.
+func readGoodsJSONL(r io.Reader, handle func(line int, row goodImportRow, err error)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), goodImportMaxLine)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var row goodImportRow
+		err := json.Unmarshal(scanner.Bytes(), &row)
+		if err != nil {
+			err = apperrors.Validation(err)
+		}
+		handle(line, row, err)
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/yudgxe/hezzl-test/internal/database/sqlc"
+	"github.com/yudgxe/hezzl-test/internal/model/clickhouse"
+	"github.com/yudgxe/hezzl-test/internal/types"
+)
+
+func TestImportKeepsUnsetFields(t *testing.T) {
+	removed := sqlc.Good{
+		ID:          7,
+		ProjectID:   1,
+		Name:        "old",
+		Description: types.NullString{NullString: sql.NullString{String: "kept", Valid: true}},
+		Removed:     true,
+	}
+	for name, tt := range map[string]struct {
+		format string
+		input  string
+	}{
+		"csv":   {"csv", "id,name,description\n7,new,\n"},
+		"jsonl": {"jsonl", `{"id":7,"name":"new"}` + "\n"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var params sqlc.UpdateGoodParams
+			db := newFakeDB(map[string]fakeQuery{
+				"UpdateGood": func(args []interface{}) ([][]interface{}, error) {
+					params.Description = args[1].(types.NullString)
+					good := removed
+					good.Name = args[0].(string)
+					return [][]interface{}{columns(good)}, nil
+				},
+				"CreateOutboxEvent": returns(),
+			})
+			logger := zerolog.Nop()
+			e := &RouterEnv{db: db, logger: &logger}
+
+			var goods []sqlc.Good
+			handle := func(line int, row goodImportRow, err error) {
+				if err == nil {
+					var good sqlc.Good
+					good, _, err = e.importGood(context.Background(), clickhouse.EventMeta{}, 1, row)
+					goods = append(goods, good)
+				}
+				if err != nil {
+					t.Fatalf("line %d: %v", line, err)
+				}
+			}
+			var err error
+			if tt.format == "csv" {
+				err = readGoodsCSV(strings.NewReader(tt.input), handle)
+			} else {
+				err = readGoodsJSONL(strings.NewReader(tt.input), handle)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if params.Description.Valid {
+				t.Errorf("expected description to be left unchanged, got %q", params.Description.String)
+			}
+			for _, call := range db.Calls() {
+				if call == "UpdateGoodRemoved" {
+					t.Errorf("expected soft-deleted good to stay removed, got calls %v", db.Calls())
+				}
+			}
+			if len(goods) != 1 || !goods[0].Removed || goods[0].Name != "new" {
+				t.Errorf("expected removed good with new name, got %+v", goods)
+			}
+		})
+	}
+}
+
+func TestReadGoodsCSVRemoved(t *testing.T) {
+	var rows []goodImportRow
+	err := readGoodsCSV(strings.NewReader("name,removed\na,\nb,true\nc,false\n"), func(line int, row goodImportRow, err error) {
+		if err != nil {
+			t.Fatalf("line %d: %v", line, err)
+		}
+		rows = append(rows, row)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0].Removed != nil || rows[1].Removed == nil || !*rows[1].Removed || rows[2].Removed == nil || *rows[2].Removed {
+		t.Errorf("expected removed to be unset, true and false, got %+v", rows)
+	}
+}
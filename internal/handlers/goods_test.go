@@ -0,0 +1,510 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/yudgxe/hezzl-test/internal/apperrors"
+	"github.com/yudgxe/hezzl-test/internal/database/sqlc"
+	"github.com/yudgxe/hezzl-test/internal/model/clickhouse"
+	"github.com/yudgxe/hezzl-test/internal/tools"
+	"github.com/yudgxe/hezzl-test/internal/types"
+)
+
+func TestGoodsWithoutRedis(t *testing.T) {
+	cache, mr := newTestCache(t)
+	guard := tools.NewRedisGuard(cache.Client, time.Hour, time.Second, cache.DelCached)
+	mr.Close()
+	// Первая команда получает ошибку соединения и помечает redis недоступным.
+	cache.Get(context.Background(), "key")
+	if guard.Up() {
+		t.Fatal("expected redis to be down")
+	}
+
+	good := sqlc.Good{ID: 1, ProjectID: 1, Name: "good", Version: 1}
+	db := newFakeDB(map[string]fakeQuery{
+		"HasGood":   returns(struct{ Exists bool }{true}),
+		"GetGood":   returns(good),
+		"MetaGood":  returns(sqlc.MetaGoodRow{Total: 1}),
+		"ListGoods": returns(good),
+	})
+	r := newTestRouter(db, cache, Config{})
+
+	for _, target := range []string{"/api/v1/good/get?id=1&project_id=1", "/api/v1/goods/list?project_id=1&limit=10&offset=0"} {
+		w := serve(r, http.MethodGet, target, "10.0.0.1:1000", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected %d, got %d: %s", target, http.StatusOK, w.Code, w.Body)
+		}
+		if !strings.Contains(w.Body.String(), `"name":"good"`) {
+			t.Errorf("%s: expected good from postgres, got %s", target, w.Body)
+		}
+	}
+	if err := cache.Get(context.Background(), "key").Err(); !errors.Is(err, tools.ErrRedisDown) {
+		t.Errorf("expected redis to stay down, got %v", err)
+	}
+}
+
+func TestGoodListCursor(t *testing.T) {
+	goods := []sqlc.Good{
+		{ID: 1, ProjectID: 1, Name: "first", Version: 1},
+		{ID: 2, ProjectID: 1, Name: "second", Version: 1},
+		{ID: 3, ProjectID: 1, Name: "third", Version: 1},
+	}
+	var afterIDs []int32
+	db := newFakeDB(map[string]fakeQuery{
+		"HasProject": returns(struct{ Exists bool }{true}),
+		"MetaGood":   returns(sqlc.MetaGoodRow{Total: int32(len(goods))}),
+		"ListGoodsAfter": func(args []interface{}) ([][]interface{}, error) {
+			after, limit := args[5].(int32), args[6].(int)
+			afterIDs = append(afterIDs, after)
+			var rows [][]interface{}
+			for _, good := range goods {
+				if good.ID > after && len(rows) < limit {
+					rows = append(rows, columns(good))
+				}
+			}
+			return rows, nil
+		},
+	})
+	cache, _ := newTestCache(t)
+	r := newTestRouter(db, cache, Config{})
+
+	type page struct {
+		Meta struct {
+			Total      int32  `json:"total"`
+			NextCursor string `json:"next_cursor"`
+		} `json:"meta"`
+		Goods []sqlc.Good `json:"goods"`
+	}
+	list := func(cursor string) page {
+		t.Helper()
+		w := serve(r, http.MethodGet, "/api/v1/goods/list?project_id=1&limit=2&cursor="+cursor, "10.0.0.1:1000", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+		}
+		var p page
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	first := list("")
+	if len(first.Goods) != 2 || first.Goods[0].ID != 1 || first.Goods[1].ID != 2 || first.Meta.Total != 3 {
+		t.Fatalf("unexpected first page %+v", first)
+	}
+	if first.Meta.NextCursor == "" {
+		t.Fatal("expected next cursor on the first page")
+	}
+	last := list(first.Meta.NextCursor)
+	if len(last.Goods) != 1 || last.Goods[0].ID != 3 {
+		t.Fatalf("unexpected last page %+v", last)
+	}
+	if last.Meta.NextCursor != "" {
+		t.Errorf("expected no next cursor on the last page, got %q", last.Meta.NextCursor)
+	}
+	if len(afterIDs) != 2 || afterIDs[0] != 0 || afterIDs[1] != 2 {
+		t.Errorf("expected pages after ids [0 2], got %v", afterIDs)
+	}
+}
+
+func TestGoodListErrors(t *testing.T) {
+	tampered := tools.Cursor{ID: 2}.Encode() + "!"
+	tests := []struct {
+		name   string
+		query  string
+		status int
+		code   int
+	}{
+		{"tampered cursor", "cursor=" + tampered, http.StatusBadRequest, apperrors.ErrInvalidCursor.Code},
+		{"cursor not json", "cursor=" + base64.RawURLEncoding.EncodeToString([]byte("2")), http.StatusBadRequest, apperrors.ErrInvalidCursor.Code},
+		{"cursor sort", "cursor=&sort_by=name", http.StatusBadRequest, apperrors.ErrCursorSort.Code},
+		{"cursor order", "cursor=&order=desc", http.StatusBadRequest, apperrors.ErrCursorSort.Code},
+		{"cursor limit", "cursor=&limit=101", http.StatusBadRequest, apperrors.ErrValidation.Code},
+		{"offset limit", "limit=101&offset=1", http.StatusBadRequest, apperrors.ErrValidation.Code},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newFakeDB(map[string]fakeQuery{
+				"HasProject": returns(struct{ Exists bool }{true}),
+			})
+			cache, _ := newTestCache(t)
+			r := newTestRouter(db, cache, Config{})
+
+			w := serve(r, http.MethodGet, "/api/v1/goods/list?project_id=1&"+tt.query, "10.0.0.1:1000", nil)
+			if w.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, w.Code, w.Body)
+			}
+			var we WebError
+			if err := json.Unmarshal(w.Body.Bytes(), &we); err != nil {
+				t.Fatal(err)
+			}
+			if we.Code != tt.code {
+				t.Errorf("expected code %d, got %d", tt.code, we.Code)
+			}
+			for _, call := range db.Calls() {
+				if call == "ListGoods" || call == "ListGoodsAfter" {
+					t.Errorf("expected no list query, got %v", db.Calls())
+				}
+			}
+		})
+	}
+}
+
+func TestGoodIfMatch(t *testing.T) {
+	good := sqlc.Good{ID: 1, ProjectID: 1, Name: "good", Version: 3}
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		body    string
+		ifMatch string
+		status  int
+	}{
+		{"update without header", http.MethodPatch, "/api/v1/good/update?id=1&project_id=1", `{"name":"good"}`, "", http.StatusOK},
+		{"update current", http.MethodPatch, "/api/v1/good/update?id=1&project_id=1", `{"name":"good"}`, `"3"`, http.StatusOK},
+		{"update any", http.MethodPatch, "/api/v1/good/update?id=1&project_id=1", `{"name":"good"}`, `*`, http.StatusOK},
+		{"update stale", http.MethodPatch, "/api/v1/good/update?id=1&project_id=1", `{"name":"good"}`, `"2"`, http.StatusPreconditionFailed},
+		{"update unquoted", http.MethodPatch, "/api/v1/good/update?id=1&project_id=1", `{"name":"good"}`, `3`, http.StatusPreconditionFailed},
+		{"update weak", http.MethodPatch, "/api/v1/good/update?id=1&project_id=1", `{"name":"good"}`, `W/"3"`, http.StatusPreconditionFailed},
+		{"remove stale", http.MethodDelete, "/api/v1/good/remove?id=1&project_id=1", "", `"2"`, http.StatusPreconditionFailed},
+		{"reprioritiize stale", http.MethodPatch, "/api/v1/good/reprioritiize?id=1&project_id=1", `{"new_priority":2}`, `"2"`, http.StatusPreconditionFailed},
+		{"restore without header", http.MethodPatch, "/api/v1/good/restore?id=1&project_id=1", "", "", http.StatusOK},
+		{"restore current", http.MethodPatch, "/api/v1/good/restore?id=1&project_id=1", "", `"3"`, http.StatusOK},
+		{"restore stale", http.MethodPatch, "/api/v1/good/restore?id=1&project_id=1", "", `"2"`, http.StatusPreconditionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newFakeDB(map[string]fakeQuery{
+				"HasGood":           returns(struct{ Exists bool }{true}),
+				"LockGood":          returns(struct{ Version int32 }{good.Version}),
+				"UpdateGood":        returns(good),
+				"UpdateGoodRemoved": returns(good),
+				"CreateOutboxEvent": returns(),
+			})
+			cache, _ := newTestCache(t)
+			r := newTestRouter(db, cache, Config{})
+
+			h := http.Header{}
+			if tt.ifMatch != "" {
+				h.Set("If-Match", tt.ifMatch)
+			}
+			w := serveBody(r, tt.method, tt.target, "10.0.0.1:1000", h, tt.body)
+			if w.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, w.Code, w.Body)
+			}
+			if etag := w.Header().Get("ETag"); etag != `"3"` {
+				t.Errorf("expected current ETag, got %q", etag)
+			}
+			if tt.status != http.StatusPreconditionFailed {
+				return
+			}
+			var we WebError
+			if err := json.Unmarshal(w.Body.Bytes(), &we); err != nil {
+				t.Fatal(err)
+			}
+			if we.Code != apperrors.ErrVersionMismatch.Code {
+				t.Errorf("expected code %d, got %d", apperrors.ErrVersionMismatch.Code, we.Code)
+			}
+			for _, call := range db.Calls() {
+				if strings.HasPrefix(call, "Update") || strings.HasPrefix(call, "Reprioritiize") {
+					t.Errorf("expected no update on version mismatch, got %v", db.Calls())
+				}
+			}
+		})
+	}
+}
+
+func TestGoodGetETag(t *testing.T) {
+	good := sqlc.Good{ID: 1, ProjectID: 1, Name: "good", Version: 3}
+	db := newFakeDB(map[string]fakeQuery{
+		"HasGood": returns(struct{ Exists bool }{true}),
+		"GetGood": returns(good),
+	})
+	cache, _ := newTestCache(t)
+	r := newTestRouter(db, cache, Config{})
+
+	// Первый запрос идет в postgres, второй отдается из кеша.
+	for i := 0; i < 2; i++ {
+		w := serve(r, http.MethodGet, "/api/v1/good/get?id=1&project_id=1", "10.0.0.1:1000", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+		}
+		if etag := w.Header().Get("ETag"); etag != `"3"` {
+			t.Errorf("request %d: expected ETag %q, got %q", i, `"3"`, etag)
+		}
+	}
+	gets := 0
+	for _, call := range db.Calls() {
+		if call == "GetGood" {
+			gets++
+		}
+	}
+	if gets != 1 {
+		t.Errorf("expected second request from cache, got %v", db.Calls())
+	}
+}
+
+func TestGoodListFilters(t *testing.T) {
+	from := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name     string
+		query    string
+		removed  string
+		pattern  string
+		fromSet  bool
+		sortBy   string
+		sortDesc bool
+	}{
+		{"default", "", "include", "", false, "id", false},
+		{"removed only", "removed=only", "only", "", false, "id", false},
+		{"removed exclude", "removed=exclude", "exclude", "", false, "id", false},
+		{"name contains", "name=a_b%25", "include", `%a\_b\%%`, false, "id", false},
+		{"name prefix", "name=ab&name_match=prefix", "include", "ab%", false, "id", false},
+		{"created from", "created_from=" + from.Format(time.RFC3339), "include", "", true, "id", false},
+		{"sort", "sort_by=priority&order=desc", "include", "", false, "priority", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var listArgs, metaArgs []interface{}
+			db := newFakeDB(map[string]fakeQuery{
+				"HasProject": returns(struct{ Exists bool }{true}),
+				"MetaGood": func(args []interface{}) ([][]interface{}, error) {
+					metaArgs = args
+					return [][]interface{}{{int32(1), int32(0)}}, nil
+				},
+				"ListGoods": func(args []interface{}) ([][]interface{}, error) {
+					listArgs = args
+					return [][]interface{}{columns(sqlc.Good{ID: 1, ProjectID: 1, Name: "good"})}, nil
+				},
+			})
+			cache, _ := newTestCache(t)
+			r := newTestRouter(db, cache, Config{})
+
+			w := serve(r, http.MethodGet, "/api/v1/goods/list?project_id=1&limit=10&offset=0&"+tt.query, "10.0.0.1:1000", nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+			}
+			if listArgs == nil {
+				t.Fatal("expected ListGoods query")
+			}
+			name := listArgs[2].(types.NullString)
+			if listArgs[1] != tt.removed || name.String != tt.pattern || name.Valid != (tt.pattern != "") {
+				t.Errorf("expected removed %q and name %q, got %v %+v", tt.removed, tt.pattern, listArgs[1], name)
+			}
+			if created := listArgs[3].(sql.NullTime); created.Valid != tt.fromSet || (tt.fromSet && !created.Time.Equal(from)) {
+				t.Errorf("expected created_from %v, got %+v", tt.fromSet, created)
+			}
+			if listArgs[5] != tt.sortBy || listArgs[6] != tt.sortDesc {
+				t.Errorf("expected sort %s desc %v, got %v %v", tt.sortBy, tt.sortDesc, listArgs[5], listArgs[6])
+			}
+			// Счетчики считаются по тем же фильтрам, что и список.
+			for i := range metaArgs {
+				if metaArgs[i] != listArgs[i] {
+					t.Errorf("expected meta with list filters, got %v and %v", metaArgs, listArgs[:len(metaArgs)])
+					break
+				}
+			}
+		})
+	}
+
+	for _, query := range []string{"removed=all", "name_match=suffix", "sort_by=description", "order=up", "created_from=yesterday"} {
+		t.Run(query, func(t *testing.T) {
+			db := newFakeDB(map[string]fakeQuery{
+				"HasProject": returns(struct{ Exists bool }{true}),
+			})
+			cache, _ := newTestCache(t)
+			r := newTestRouter(db, cache, Config{})
+
+			w := serve(r, http.MethodGet, "/api/v1/goods/list?project_id=1&"+query, "10.0.0.1:1000", nil)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestGoodListCachedMeta(t *testing.T) {
+	goods := []sqlc.Good{
+		{ID: 1, ProjectID: 1, Name: "first"},
+		{ID: 2, ProjectID: 1, Name: "second", Removed: true},
+	}
+	db := newFakeDB(map[string]fakeQuery{
+		"HasProject": returns(struct{ Exists bool }{true}),
+		"MetaGood":   returns(sqlc.MetaGoodRow{Total: 5, Removed: 1}),
+		"ListGoods":  returns(goods[0], goods[1]),
+	})
+	cache, _ := newTestCache(t)
+	r := newTestRouter(db, cache, Config{})
+
+	for i := 0; i < 2; i++ {
+		w := serve(r, http.MethodGet, "/api/v1/goods/list?project_id=1&limit=2&offset=0", "10.0.0.1:1000", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+		}
+		var response struct {
+			Meta struct {
+				Total   int32 `json:"total"`
+				Removed int32 `json:"removed"`
+				Limit   int   `json:"limit"`
+			} `json:"meta"`
+			Goods []sqlc.Good `json:"goods"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		if response.Meta.Total != 5 || response.Meta.Removed != 1 || response.Meta.Limit != 2 || len(response.Goods) != 2 {
+			t.Errorf("request %d: expected total 5, removed 1, limit 2 and 2 goods, got %s", i, w.Body)
+		}
+	}
+	lists := 0
+	for _, call := range db.Calls() {
+		if call == "ListGoods" {
+			lists++
+		}
+	}
+	if lists != 1 {
+		t.Errorf("expected second page from cache, got %v", db.Calls())
+	}
+}
+
+// recordGoodEvents - CreateOutboxEvent, который складывает события товаров в events.
+func recordGoodEvents(events *[]clickhouse.Good) fakeQuery {
+	return func(args []interface{}) ([][]interface{}, error) {
+		var event clickhouse.Good
+		if err := json.Unmarshal(args[1].(pgtype.JSONB).Bytes, &event); err != nil {
+			return nil, err
+		}
+		*events = append(*events, event)
+		return nil, nil
+	}
+}
+
+func TestGoodRestore(t *testing.T) {
+	restored := sqlc.Good{ID: 1, ProjectID: 1, Name: "good", Version: 2}
+	var events []clickhouse.Good
+	var removedArgs []interface{}
+	db := newFakeDB(map[string]fakeQuery{
+		// Удален только товар с id 1.
+		"HasGood": func(args []interface{}) ([][]interface{}, error) {
+			return [][]interface{}{{args[0].(int32) == 1 && args[2].(bool)}}, nil
+		},
+		"UpdateGoodRemoved": func(args []interface{}) ([][]interface{}, error) {
+			removedArgs = args
+			return [][]interface{}{columns(restored)}, nil
+		},
+		"CreateOutboxEvent": recordGoodEvents(&events),
+	})
+	cache, _ := newTestCache(t)
+	r := newTestRouter(db, cache, Config{})
+
+	w := serve(r, http.MethodPatch, "/api/v1/good/restore?id=1&project_id=1", "10.0.0.1:1000", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+	if removedArgs == nil || removedArgs[0] != false {
+		t.Errorf("expected removed flag to be cleared, got %v", removedArgs)
+	}
+	if len(events) != 1 || events[0].ID != 1 || events[0].EventType != clickhouse.EventRestored {
+		t.Errorf("expected restored event in outbox, got %+v", events)
+	}
+	if etag := w.Header().Get("ETag"); etag != `"2"` {
+		t.Errorf("expected ETag of restored good, got %q", etag)
+	}
+
+	// Восстановить можно только удаленный товар.
+	w = serve(r, http.MethodPatch, "/api/v1/good/restore?id=2&project_id=1", "10.0.0.1:1000", nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected %d for not removed good, got %d: %s", http.StatusNotFound, w.Code, w.Body)
+	}
+}
+
+func TestGoodPurge(t *testing.T) {
+	purged := []sqlc.Good{
+		{ID: 1, ProjectID: 1, Name: "first", Removed: true},
+		{ID: 2, ProjectID: 1, Name: "second", Removed: true},
+	}
+	tests := []struct {
+		name   string
+		query  string
+		token  string
+		rows   []sqlc.Good
+		status int
+		code   int
+		events int
+	}{
+		{"without token", "project_id=1", "", purged, http.StatusForbidden, apperrors.ErrAdminForbidden.Code, 0},
+		{"wrong token", "project_id=1", "wrong", purged, http.StatusForbidden, apperrors.ErrAdminForbidden.Code, 0},
+		{"project", "project_id=1", "secret", purged, http.StatusOK, 0, 2},
+		{"good", "project_id=1&id=1", "secret", purged[:1], http.StatusOK, 0, 1},
+		{"good not removed", "project_id=1&id=3", "secret", nil, http.StatusNotFound, apperrors.ErrGoodNotFound.Code, 0},
+		{"nothing to purge", "project_id=1", "secret", nil, http.StatusOK, 0, 0},
+		{"bad id", "project_id=1&id=x", "secret", nil, http.StatusBadRequest, apperrors.ErrValidation.Code, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var events []clickhouse.Good
+			rows := make([]interface{}, 0, len(tt.rows))
+			for _, good := range tt.rows {
+				rows = append(rows, good)
+			}
+			db := newFakeDB(map[string]fakeQuery{
+				"PurgeGoods":        returns(rows...),
+				"CreateOutboxEvent": recordGoodEvents(&events),
+			})
+			cache, _ := newTestCache(t)
+			for _, good := range purged {
+				if err := cache.SetGoodWithID(context.Background(), good, time.Minute); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r := newTestRouter(db, cache, Config{AdminToken: "secret"})
+
+			h := http.Header{}
+			if tt.token != "" {
+				h.Set("X-Admin-Token", tt.token)
+			}
+			w := serve(r, http.MethodDelete, "/api/v1/good/purge?"+tt.query, "10.0.0.1:1000", h)
+			if w.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, w.Code, w.Body)
+			}
+			if tt.status != http.StatusOK {
+				var we WebError
+				if err := json.Unmarshal(w.Body.Bytes(), &we); err != nil {
+					t.Fatal(err)
+				}
+				if we.Code != tt.code {
+					t.Errorf("expected code %d, got %d", tt.code, we.Code)
+				}
+				if db.Commits() != 0 {
+					t.Errorf("expected no commit, got %d", db.Commits())
+				}
+			}
+			if len(events) != tt.events {
+				t.Fatalf("expected %d events, got %+v", tt.events, events)
+			}
+			for _, event := range events {
+				if event.EventType != clickhouse.EventPurged {
+					t.Errorf("expected purged event, got %+v", event)
+				}
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			// Удаленные из базы товары не должны отдаваться из кеша.
+			for _, good := range tt.rows {
+				if _, ok, _ := cache.GetGood(context.Background(), good.ID, good.ProjectID); ok {
+					t.Errorf("expected good %d to be removed from cache", good.ID)
+				}
+			}
+		})
+	}
+}
@@ -2,13 +2,15 @@ package handlers
 
 import (
 	"context"
-	"net/http"
+	"crypto/subtle"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v4"
-	"github.com/nats-io/nats.go"
+	"github.com/yudgxe/hezzl-test/internal/apperrors"
+	"github.com/yudgxe/hezzl-test/internal/auth"
 	"github.com/yudgxe/hezzl-test/internal/database/sqlc"
+	"github.com/yudgxe/hezzl-test/internal/metrics"
 	"github.com/yudgxe/hezzl-test/internal/tools"
 
 	"github.com/rs/zerolog"
@@ -17,6 +19,7 @@ import (
 
 	swaggerfiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 // @title           hezzl API
@@ -29,17 +32,35 @@ import (
 // @contact.email   support@swagger.io
 // @license.name    Apache 2.0
 // @license.url     http://www.apache.org/licenses/LICENSE-2.0.html
-func Urls(db DBTX, cache Cache, logger *zerolog.Logger, nats *nats.EncodedConn, r *gin.Engine) *gin.Engine {
+// @securityDefinitions.apikey ApiKeyAuth
+// @in              header
+// @name            X-API-Key
+// @securityDefinitions.apikey BearerAuth
+// @in              header
+// @name            Authorization
+func Urls(db DBTX, cache Cache, logger *zerolog.Logger, config Config, r *gin.Engine) *gin.Engine {
+	// Контекст запроса со спаном otelgin должен доходить до базы и redis через *gin.Context.
+	r.ContextWithFallback = true
+	// gin по умолчанию верит X-Forwarded-For от всех, тогда лимит по ip обходится подменой заголовка.
+	if err := r.SetTrustedProxies(config.TrustedProxies); err != nil {
+		logger.Error().Err(err).Msg("invalid trusted proxies, X-Forwarded-For is ignored")
+		r.SetTrustedProxies(nil)
+	}
+	r.Use(otelgin.Middleware("hezzl-api"), metricsMiddleware)
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
 
 	env := &RouterEnv{
-		db:        db,
-		cache:     cache,
-		logger:    logger,
-		publisher: nats,
+		db:     db,
+		cache:  cache,
+		logger: logger,
+		config: config,
 	}
 
-	v1 := r.Group("/api/v1")
+	r.GET("/healthz", healthz)
+	r.GET("/readyz", env.readyz)
+
+	v1 := r.Group("/api/v1", requestIDMiddleware, env.ipRateLimitMiddleware, env.authMiddleware, env.rateLimitMiddleware)
 	{
 		gg := v1.Group("/good")
 		{
@@ -47,13 +68,43 @@ func Urls(db DBTX, cache Cache, logger *zerolog.Logger, nats *nats.EncodedConn,
 			gg.PATCH("/update", env.goodMiddleware, env.goodUpdate)
 			gg.DELETE("/remove", env.goodMiddleware, env.goodRemove)
 			gg.PATCH("/reprioritiize", env.goodMiddleware, env.goodReprioritiize)
+			gg.GET("/get", env.goodMiddleware, env.goodGet)
+			gg.PATCH("/restore", env.removedGoodMiddleware, env.goodRestore)
+			gg.DELETE("/purge", env.adminMiddleware, env.goodPurge)
 		}
 
 		v1.GET("/goods/list", env.goodList)
+		v1.POST("/goods/batch", env.goodBatch)
+		v1.GET("/goods/export", env.goodExport)
+		v1.POST("/goods/import", env.goodImport)
+
+		pg := v1.Group("/project")
+		{
+			pg.POST("/create", requireAdmin, env.projectCreate)
+			pg.PATCH("/update", env.projectMiddleware, env.projectUpdate)
+			pg.DELETE("/remove", requireAdmin, env.projectMiddleware, env.projectRemove)
+			pg.GET("/get", env.projectMiddleware, env.projectGet)
+		}
+
+		v1.GET("/projects/list", requireAdmin, env.projectList)
 	}
 	return r
 }
 
+// Config - настройки хендлеров.
+type Config struct {
+	// AdminToken - токен для админских ручек, если пустой, то админские ручки доступны только ключам администраторов.
+	AdminToken string
+	// Auth - аутентификация клиентов, nil - api открыт для всех.
+	Auth auth.Authenticator
+	// RateLimit - лимиты запросов на клиента, нулевые лимиты - без ограничений.
+	RateLimit RateLimitConfig
+	// TrustedProxies - прокси, которым верим в X-Forwarded-For, nil - ip клиента берется из соединения.
+	TrustedProxies []string
+	// Health - проверки зависимостей для /readyz, nil - /readyz отвечает как /healthz.
+	Health *tools.HealthChecker
+}
+
 // DBTX - интерфейс для создания Queries и транзакций.
 type DBTX interface {
 	sqlc.DBTX
@@ -68,30 +119,65 @@ type Cache interface {
 	ScanKey(ctx context.Context, match string) (string, bool, error)
 
 	SetGood(ctx context.Context, good sqlc.Good, expiration time.Duration, ifexist bool) error
-	SetGoodWihtPagination(ctx context.Context, good sqlc.Good, expiration time.Duration, ifexist bool, pagination int) error
+	SetGoods(ctx context.Context, goods []sqlc.Good, expiration time.Duration, ifexist bool) error
+	SetGoodWihtPagination(ctx context.Context, good sqlc.Good, expiration time.Duration, ifexist bool, scope int32, pagination int) error
+	SetGoodWithID(ctx context.Context, good sqlc.Good, expiration time.Duration) error
+
+	GetGood(ctx context.Context, id, projectID int32) (sqlc.Good, bool, error)
+	DelGoods(ctx context.Context, goods []sqlc.Good) error
 
-	GetGoodsWithPagination(ctx context.Context, pagination tools.Pagination) ([]sqlc.Good, *tools.GetGoodsWithPaginationReponse, error)
+	GetGoodsWithPagination(ctx context.Context, scope int32, pagination tools.Pagination) ([]sqlc.Good, *tools.GetGoodsWithPaginationReponse, error)
+
+	SetGoodsPage(ctx context.Context, scope int32, cursor string, limit int, goods []sqlc.Good, next string, expiration time.Duration) error
+	GetGoodsPage(ctx context.Context, scope int32, cursor string, limit int) ([]sqlc.Good, string, bool, error)
+	DelGoodsPages(ctx context.Context) error
+
+	SetProject(ctx context.Context, project sqlc.Project, expiration time.Duration) error
+	GetProject(ctx context.Context, id int32) (sqlc.Project, bool, error)
+	DelProject(ctx context.Context, id int32) error
+
+	ReserveIdempotencyKey(ctx context.Context, scope, key, hash string, expiration time.Duration) (bool, error)
+	GetIdempotencyKey(ctx context.Context, scope, key string) (tools.IdempotentResponse, bool, error)
+	SetIdempotencyKey(ctx context.Context, scope, key string, response tools.IdempotentResponse, expiration time.Duration) error
+	DelIdempotencyKey(ctx context.Context, scope, key string) error
+
+	AllowRate(ctx context.Context, class, client string, limit tools.RateLimit) (tools.RateLimitResult, error)
 }
 
 type RouterEnv struct {
-	db        DBTX
-	cache     Cache
-	publisher *nats.EncodedConn
-	logger    *zerolog.Logger
+	db     DBTX
+	cache  Cache
+	logger *zerolog.Logger
+	config Config
 }
 
 func (e *RouterEnv) sql() *sqlc.Queries {
 	return sqlc.New(e.db)
 }
 
+// adminMiddleware - пропускает только запросы с токеном администратора в заголовке X-Admin-Token
+// или с ключом администратора.
+func (e *RouterEnv) adminMiddleware(g *gin.Context) {
+	if p := principal(g); p != nil && p.Admin {
+		g.Next()
+		return
+	}
+	token := g.GetHeader("X-Admin-Token")
+	if e.config.AdminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(e.config.AdminToken)) != 1 {
+		handleError(g, apperrors.ErrAdminForbidden)
+		return
+	}
+	g.Next()
+}
+
 // bindAndValidate - биндит и валидирует body, при ошибках пишет их в ответ и возвращает false.
 func bindAndValidate(g *gin.Context, body interface{}) bool {
 	if err := g.ShouldBindJSON(&body); err != nil {
-		g.JSON(http.StatusBadRequest, WebError{Code: 0, Message: err.Error()})
+		handleError(g, apperrors.Validation(err))
 		return false
 	}
 	if err := validator.Validate(&body); err != nil {
-		g.JSON(http.StatusBadRequest, WebError{Code: 0, Message: err.Error()})
+		handleError(g, apperrors.Validation(err))
 		return false
 	}
 	return true
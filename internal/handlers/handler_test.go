@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"github.com/yudgxe/hezzl-test/internal/tools"
+)
+
+// newTestCache - кеш на miniredis.
+func newTestCache(t *testing.T) (*tools.Cache, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return tools.NewCache(client), mr
+}
+
+// newTestRouter - роутер со всеми хендлерами.
+func newTestRouter(db DBTX, cache Cache, config Config) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	logger := zerolog.Nop()
+	return Urls(db, cache, &logger, config, gin.New())
+}
+
+// serve - выполняет запрос от клиента с адресом remoteAddr.
+func serve(r http.Handler, method, target, remoteAddr string, header http.Header) *httptest.ResponseRecorder {
+	return serveBody(r, method, target, remoteAddr, header, "")
+}
+
+// serveBody - как serve, но с json телом.
+func serveBody(r http.Handler, method, target, remoteAddr string, header http.Header, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.RemoteAddr = remoteAddr
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yudgxe/hezzl-test/internal/tools"
+)
+
+// healthz - процесс жив и отвечает на запросы, зависимости не проверяются.
+func healthz(g *gin.Context) {
+	g.JSON(http.StatusOK, map[string]interface{}{
+		"status": tools.HealthUp,
+	})
+}
+
+// readyz - готовность принимать трафик. Отвечает 503, только если недоступна критичная зависимость,
+// без redis сервис работает в режиме degraded и отвечает 200.
+func (e *RouterEnv) readyz(g *gin.Context) {
+	if e.config.Health == nil {
+		healthz(g)
+		return
+	}
+	report := e.config.Health.Check(g)
+	status := http.StatusOK
+	if report.Status == tools.HealthDown {
+		status = http.StatusServiceUnavailable
+	}
+	g.JSON(status, report)
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yudgxe/hezzl-test/internal/apperrors"
+	"github.com/yudgxe/hezzl-test/internal/tools"
+)
+
+const (
+	goodCreateIdempotencyScope = "good_create"
+
+	// idempotencyPendingTTL - сколько держится ключ запроса, который еще выполняется.
+	idempotencyPendingTTL = time.Second * 30
+	// idempotencyTTL - сколько хранится ответ для повтора.
+	idempotencyTTL = time.Hour * 24
+)
+
+// idempotencyScope - scope ключей клиента запроса. Ключи выбирают клиенты, поэтому без клиента в scope
+// другой клиент с тем же ключом и телом получил бы чужой ответ. Клиент в кавычках, чтобы "_" в нем
+// и в ключе не давали одинаковых ключей redis.
+func idempotencyScope(g *gin.Context, scope string) string {
+	return fmt.Sprintf("%s_%q", scope, g.GetString(subjectKey))
+}
+
+// requestHash - хеш параметров запроса, по нему проверяется, что под ключом повторяют тот же запрос.
+func requestHash(params ...interface{}) string {
+	b, _ := json.Marshal(params)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// reserveIdempotencyKey - занимает Idempotency-Key под запрос. Если ключ уже использован, то
+// повторяет сохраненный ответ, либо отвечает 422 (другое тело запроса) или 409 (запрос еще выполняется).
+// Возвращает true, если запрос нужно выполнить.
+func (e *RouterEnv) reserveIdempotencyKey(g *gin.Context, scope, key, hash string) bool {
+	reserved, err := e.cache.ReserveIdempotencyKey(g, scope, key, hash, idempotencyPendingTTL)
+	if err != nil {
+		handleError(g, apperrors.ErrCacheUnavailable.Wrap(err))
+		return false
+	}
+	if reserved {
+		return true
+	}
+
+	response, ok, err := e.cache.GetIdempotencyKey(g, scope, key)
+	if err != nil {
+		handleError(g, apperrors.ErrCacheUnavailable.Wrap(err))
+		return false
+	}
+	switch {
+	case !ok:
+		// Ключ успел истечь между SETNX и GET, пробуем занять еще раз.
+		return e.reserveIdempotencyKey(g, scope, key, hash)
+	case response.Hash != hash:
+		handleError(g, apperrors.ErrIdempotencyKeyReused)
+	case response.Pending:
+		handleError(g, apperrors.ErrIdempotencyInProgress)
+	default:
+		if response.ETag != "" {
+			g.Header("ETag", response.ETag)
+		}
+		g.Header("Idempotent-Replayed", "true")
+		g.Data(response.Status, "application/json; charset=utf-8", response.Body)
+	}
+	return false
+}
+
+// saveIdempotentResponse - сохраняет ответ под ключом, пустой ключ игнорируется.
+func (e *RouterEnv) saveIdempotentResponse(g *gin.Context, scope, key, hash string, status int, body interface{}) {
+	if key == "" {
+		return
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		e.logger.Error().Err(err).Msg("failed to marshal idempotent response")
+		return
+	}
+	response := tools.IdempotentResponse{
+		Hash:   hash,
+		Status: status,
+		ETag:   g.Writer.Header().Get("ETag"),
+		Body:   b,
+	}
+	if err := e.cache.SetIdempotencyKey(g, scope, key, response, idempotencyTTL); err != nil {
+		e.logger.Error().Err(err).Msg("failed to save idempotent response")
+	}
+}
+
+// releaseIdempotencyKey - освобождает ключ после неудачного запроса, чтобы его можно было повторить.
+func (e *RouterEnv) releaseIdempotencyKey(g *gin.Context, scope, key string) {
+	if key == "" {
+		return
+	}
+	if err := e.cache.DelIdempotencyKey(g, scope, key); err != nil {
+		e.logger.Error().Err(err).Msg("failed to release idempotency key")
+	}
+}
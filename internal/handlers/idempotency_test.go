@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/yudgxe/hezzl-test/internal/auth"
+	"github.com/yudgxe/hezzl-test/internal/database/sqlc"
+)
+
+func TestIdempotencyKeyPerClient(t *testing.T) {
+	keys := map[string]sqlc.ApiKey{
+		auth.HashAPIKey("hz_first"):  {ID: 1},
+		auth.HashAPIKey("hz_second"): {ID: 2},
+	}
+	var created int32
+	db := newFakeDB(map[string]fakeQuery{
+		"GetAPIKeyByHash": func(args []interface{}) ([][]interface{}, error) {
+			if key, ok := keys[args[0].(string)]; ok {
+				return [][]interface{}{columns(key)}, nil
+			}
+			return nil, nil
+		},
+		"ListAPIKeyProjects": returns(sqlc.ListAPIKeyProjectsRow{ProjectID: 1, Scope: string(auth.ScopeWrite)}),
+		"CreateGood": func(args []interface{}) ([][]interface{}, error) {
+			created++
+			return [][]interface{}{columns(sqlc.Good{ID: created, ProjectID: 1, Name: "good", Version: 1})}, nil
+		},
+		"CreateOutboxEvent": returns(),
+	})
+	cache, _ := newTestCache(t)
+	r := newTestRouter(db, cache, Config{Auth: auth.NewAPIKeyAuthenticator(sqlc.New(db))})
+	create := func(key string) *http.Response {
+		header := http.Header{}
+		header.Set(auth.APIKeyHeader, key)
+		header.Set("Idempotency-Key", "same")
+		w := serveBody(r, http.MethodPost, "/api/v1/good/create?project_id=1", "10.0.0.1:1000", header, `{"name":"good"}`)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("%s: expected %d, got %d: %s", key, http.StatusCreated, w.Code, w.Body)
+		}
+		return w.Result()
+	}
+
+	for i, tt := range []struct {
+		key      string
+		replayed bool
+		created  int32
+	}{
+		{key: "hz_first", created: 1},
+		{key: "hz_second", created: 2},
+		{key: "hz_first", replayed: true, created: 2},
+		{key: "hz_second", replayed: true, created: 2},
+	} {
+		t.Run(fmt.Sprintf("%d %s", i, tt.key), func(t *testing.T) {
+			resp := create(tt.key)
+			if replayed := resp.Header.Get("Idempotent-Replayed") == "true"; replayed != tt.replayed {
+				t.Errorf("expected replayed %v, got %v", tt.replayed, replayed)
+			}
+			if created != tt.created {
+				t.Errorf("expected %d goods created, got %d", tt.created, created)
+			}
+		})
+	}
+}
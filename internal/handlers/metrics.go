@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yudgxe/hezzl-test/internal/metrics"
+)
+
+// metricsMiddleware - считает запросы и время их обработки. Путь берется из шаблона роута gin,
+// чтобы id в query и неизвестные пути не раздували число рядов.
+func metricsMiddleware(g *gin.Context) {
+	start := time.Now()
+	g.Next()
+
+	route := g.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	status := strconv.Itoa(g.Writer.Status())
+	metrics.HTTPRequests.WithLabelValues(g.Request.Method, route, status).Inc()
+	metrics.HTTPRequestDuration.WithLabelValues(g.Request.Method, route, status).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jackc/pgtype"
+	"github.com/yudgxe/hezzl-test/internal/database/sqlc"
+	"github.com/yudgxe/hezzl-test/internal/model/clickhouse"
+	"github.com/yudgxe/hezzl-test/internal/tracing"
+)
+
+// enqueue - пишет события в outbox в транзакции q, в nats их потом отправит tools.OutboxRelay.
+// Вместе с событием сохраняется контекст трейса из ctx.
+func enqueue(ctx context.Context, q *sqlc.Queries, subject string, events ...interface{}) error {
+	headers, err := json.Marshal(tracing.Headers(ctx))
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if err := q.CreateOutboxEvent(ctx, sqlc.CreateOutboxEventParams{
+			Subject: subject,
+			Payload: pgtype.JSONB{Bytes: payload, Status: pgtype.Present},
+			Headers: pgtype.JSONB{Bytes: headers, Status: pgtype.Present},
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enqueueGoods - пишет события изменения товаров в outbox.
+func enqueueGoods(ctx context.Context, q *sqlc.Queries, meta clickhouse.EventMeta, eventType clickhouse.EventType, goods ...sqlc.Good) error {
+	events := make([]interface{}, 0, len(goods))
+	for _, good := range goods {
+		events = append(events, clickhouse.FromGoodSQLC(good, eventType, meta))
+	}
+	return enqueue(ctx, q, goodSubj, events...)
+}
+
+// enqueueProject - пишет событие изменения проекта в outbox.
+func enqueueProject(ctx context.Context, q *sqlc.Queries, project sqlc.Project) error {
+	return enqueue(ctx, q, projectSubj, clickhouse.FromProjectSQLC(project))
+}
+
+// createGood - создает товар вместе с записью в outbox.
+func (e *RouterEnv) createGood(ctx context.Context, meta clickhouse.EventMeta, arg sqlc.CreateGoodParams) (sqlc.Good, error) {
+	tx, err := e.db.Begin(ctx)
+	if err != nil {
+		return sqlc.Good{}, err
+	}
+	defer tx.Rollback(context.Background())
+
+	qtx := e.sql().WithTx(tx)
+	good, err := qtx.CreateGood(ctx, arg)
+	if err != nil {
+		return good, err
+	}
+	if err := enqueueGoods(ctx, qtx, meta, clickhouse.EventCreated, good); err != nil {
+		return good, err
+	}
+	return good, tx.Commit(ctx)
+}
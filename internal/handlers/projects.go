@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yudgxe/hezzl-test/internal/apperrors"
+	"github.com/yudgxe/hezzl-test/internal/database/sqlc"
+	"github.com/yudgxe/hezzl-test/internal/model/clickhouse"
+	"github.com/yudgxe/hezzl-test/internal/tools"
+)
+
+const projectSubj = "logs.project"
+
+// ProjectMiddleware - парсит с url id проекта, а так же проверяет существование записи.
+func (e *RouterEnv) projectMiddleware(g *gin.Context) {
+	projectID, ok := int32Query(g, "id")
+	if !ok {
+		g.Abort()
+		return
+	}
+	if !authorize(g, projectID, methodScope(g)) {
+		return
+	}
+	exist, err := e.sql().HasProject(g, projectID)
+	if err != nil {
+		handleError(g, err)
+		return
+	}
+	if !exist {
+		handleError(g, apperrors.ErrProjectNotFound)
+		return
+	}
+
+	g.Set("project_id", projectID)
+	g.Next()
+}
+
+type projectCreateBody struct {
+	Name string `json:"name" binding:"required" example:"name"`
+}
+
+// @Summary				Create project
+// @Param request       body projectCreateBody{} true "query params"
+// @Description			Create project.
+// @Produce				application/json
+// @Tags				projects
+// @Security			ApiKeyAuth
+// @Security			BearerAuth
+// @Router              /project/create [post]
+func (e *RouterEnv) projectCreate(g *gin.Context) {
+	var body projectCreateBody
+	if ok := bindAndValidate(g, &body); !ok {
+		return
+	}
+	tx, err := e.db.Begin(g)
+	if err != nil {
+		handleError(g, err)
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	qtx := e.sql().WithTx(tx)
+	project, err := qtx.CreateProject(g, body.Name)
+	if err != nil {
+		handleError(g, err)
+		return
+	}
+	if err := enqueueProject(g, qtx, project); err != nil {
+		handleError(g, err)
+		return
+	}
+	if err := tx.Commit(g); err != nil {
+		handleError(g, err)
+		return
+	}
+	g.JSON(http.StatusCreated, project)
+	e.logger.Info().Interface("project", project).Msg("created project")
+}
+
+type projectUpdateBody struct {
+	Name string `json:"name" binding:"required" example:"name"`
+}
+
+// @Summary				Update project
+// @Param               id query int true "Project id"
+// @Param request       body projectUpdateBody{} true "query params"
+// @Description			Update project.
+// @Produce				application/json
+// @Tags				projects
+// @Security			ApiKeyAuth
+// @Security			BearerAuth
+// @Router              /project/update [PATCH]
+func (e *RouterEnv) projectUpdate(g *gin.Context) {
+	projectID := g.MustGet("project_id").(int32)
+	var body projectUpdateBody
+	if ok := bindAndValidate(g, &body); !ok {
+		return
+	}
+	tx, err := e.db.Begin(g)
+	if err != nil {
+		handleError(g, err)
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	qtx := e.sql().WithTx(tx)
+	project, err := qtx.UpdateProject(g, sqlc.UpdateProjectParams{
+		Name: body.Name,
+		ID:   projectID,
+	})
+	if err != nil {
+		handleError(g, err)
+		return
+	}
+	if err := enqueueProject(g, qtx, project); err != nil {
+		handleError(g, err)
+		return
+	}
+	if err := tx.Commit(g); err != nil {
+		handleError(g, err)
+		return
+	}
+	g.JSON(http.StatusOK, project)
+	e.logger.Info().Interface("project", project).Msg("updated")
+	if err := e.cache.SetProject(g, project, time.Second*60); err != nil {
+		e.logger.Error().Err(err).Msg("failed to updated cache")
+	}
+}
+
+// @Summary				Delete project
+// @Param               id query int true "Project id"
+// @Description			Delete project with all its goods, admin only. Goods are purged with events.
+// @Produce				application/json
+// @Tags				projects
+// @Security			ApiKeyAuth
+// @Security			BearerAuth
+// @Router              /project/remove [DELETE]
+func (e *RouterEnv) projectRemove(g *gin.Context) {
+	projectID := g.MustGet("project_id").(int32)
+	tx, err := e.db.Begin(g)
+	if err != nil {
+		handleError(g, err)
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	qtx := e.sql().WithTx(tx)
+	// Без блокировки товар, созданный между удалением товаров и проекта, удалится каскадно без события.
+	if _, err := qtx.LockProject(g, projectID); err != nil {
+		handleError(g, err)
+		return
+	}
+	purged, err := qtx.DeleteProjectGoods(g, projectID)
+	if err != nil {
+		handleError(g, err)
+		return
+	}
+	if err := enqueueGoods(g, qtx, eventMeta(g), clickhouse.EventPurged, purged...); err != nil {
+		handleError(g, err)
+		return
+	}
+	project, err := qtx.DeleteProject(g, projectID)
+	if err != nil {
+		handleError(g, err)
+		return
+	}
+	if err := enqueueProject(g, qtx, project); err != nil {
+		handleError(g, err)
+		return
+	}
+	if err := tx.Commit(g); err != nil {
+		handleError(g, err)
+		return
+	}
+	g.JSON(http.StatusOK, map[string]interface{}{
+		"id":      projectID,
+		"removed": true,
+		"purged":  len(purged),
+	})
+	e.logger.Info().Interface("project", project).Msg("removed")
+	if err := e.cache.DelProject(g, projectID); err != nil {
+		e.logger.Error().Err(err).Msg("failed to update cache")
+	}
+}
+
+// @Summary				Get project
+// @Param               id query int true "Project id"
+// @Description			Get project.
+// @Produce				application/json
+// @Tags				projects
+// @Security			ApiKeyAuth
+// @Security			BearerAuth
+// @Router              /project/get [GET]
+func (e *RouterEnv) projectGet(g *gin.Context) {
+	projectID := g.MustGet("project_id").(int32)
+	project, ok, err := e.cache.GetProject(g, projectID)
+	if err != nil {
+		e.logger.Error().Err(err).Msg("failed to get cache")
+	}
+	if ok {
+		g.JSON(http.StatusOK, project)
+		return
+	}
+	project, err = e.sql().GetProject(g, projectID)
+	if err != nil {
+		handleError(g, err)
+		return
+	}
+	g.JSON(http.StatusOK, project)
+	if err := e.cache.SetProject(g, project, time.Second*60); err != nil {
+		e.logger.Error().Err(err).Msg("failed to update cash")
+	}
+}
+
+// @Summary				List projects
+// @Description			List projects.
+// @Param               limit query int true "Limit" default(10) maximum(100)
+// @Param               offset query int true "Offset" default(1)
+// @Produce				application/json
+// @Tags				projects
+// @Security			ApiKeyAuth
+// @Security			BearerAuth
+// @Router              /projects/list [GET]
+func (e *RouterEnv) projectList(g *gin.Context) {
+	pagination, err := tools.GetPagination(g)
+	if err != nil {
+		handleError(g, paginationError(err))
+		return
+	}
+
+	tx, err := e.db.Begin(g)
+	if err != nil {
+		handleError(g, err)
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	qtx := e.sql().WithTx(tx)
+	total, err := qtx.MetaProject(g)
+	if err != nil {
+		handleError(g, err)
+		return
+	}
+	projects, err := qtx.ListProjects(g, sqlc.ListProjectsParams{
+		Limit:  pagination.Limit,
+		Offset: pagination.Offset,
+	})
+	if err != nil {
+		handleError(g, err)
+		return
+	}
+	if err := tx.Commit(g); err != nil {
+		handleError(g, err)
+		return
+	}
+	g.JSON(http.StatusOK, map[string]interface{}{
+		"meta": map[string]interface{}{
+			"total":  total,
+			"limit":  pagination.Limit,
+			"offset": pagination.Offset,
+		},
+		"projects": projects,
+	})
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgtype"
+	"github.com/yudgxe/hezzl-test/internal/apperrors"
+	"github.com/yudgxe/hezzl-test/internal/auth"
+	"github.com/yudgxe/hezzl-test/internal/database/sqlc"
+	"github.com/yudgxe/hezzl-test/internal/model/clickhouse"
+)
+
+func TestProjectEventsOutbox(t *testing.T) {
+	project := sqlc.Project{ID: 1, Name: "project"}
+	tests := []struct {
+		method string
+		target string
+		body   string
+		status int
+	}{
+		{http.MethodPost, "/api/v1/project/create", `{"name":"project"}`, http.StatusCreated},
+		{http.MethodPatch, "/api/v1/project/update?id=1", `{"name":"project"}`, http.StatusOK},
+		{http.MethodDelete, "/api/v1/project/remove?id=1", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			var subjects []string
+			var events []clickhouse.Project
+			outboxErr := error(nil)
+			db := newFakeDB(map[string]fakeQuery{
+				"HasProject":         returns(struct{ Exists bool }{true}),
+				"CreateProject":      returns(project),
+				"UpdateProject":      returns(project),
+				"DeleteProject":      returns(project),
+				"LockProject":        returns(struct{ ID int32 }{1}),
+				"DeleteProjectGoods": returns(),
+				"CreateOutboxEvent": func(args []interface{}) ([][]interface{}, error) {
+					var event clickhouse.Project
+					if err := json.Unmarshal(args[1].(pgtype.JSONB).Bytes, &event); err != nil {
+						return nil, err
+					}
+					subjects = append(subjects, args[0].(string))
+					events = append(events, event)
+					return nil, outboxErr
+				},
+			})
+			cache, _ := newTestCache(t)
+			r := newTestRouter(db, cache, Config{})
+			request := func() *httptest.ResponseRecorder {
+				return serveBody(r, tt.method, tt.target, "10.0.0.1:1000", nil, tt.body)
+			}
+
+			w := request()
+			if w.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, w.Code, w.Body)
+			}
+			if len(subjects) != 1 || subjects[0] != projectSubj || events[0].ID != project.ID {
+				t.Errorf("expected project event in outbox, got %v %+v", subjects, events)
+			}
+
+			// Без записи в outbox изменение не подтверждается клиенту.
+			outboxErr = errors.New("outbox is full")
+			if w := request(); w.Code != http.StatusInternalServerError {
+				t.Errorf("expected %d when outbox fails, got %d: %s", http.StatusInternalServerError, w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestProjectRemove(t *testing.T) {
+	project := sqlc.Project{ID: 1, Name: "project"}
+	goods := []interface{}{
+		sqlc.Good{ID: 1, ProjectID: 1, Name: "a", Version: 1},
+		sqlc.Good{ID: 2, ProjectID: 1, Name: "b", Removed: true, Version: 3},
+	}
+	keys := map[string]sqlc.ApiKey{
+		auth.HashAPIKey("hz_writer"): {ID: 1},
+		auth.HashAPIKey("hz_admin"):  {ID: 2, IsAdmin: true},
+	}
+	var outbox []string
+	db := newFakeDB(map[string]fakeQuery{
+		"GetAPIKeyByHash": func(args []interface{}) ([][]interface{}, error) {
+			if key, ok := keys[args[0].(string)]; ok {
+				return [][]interface{}{columns(key)}, nil
+			}
+			return nil, nil
+		},
+		"ListAPIKeyProjects": returns(sqlc.ListAPIKeyProjectsRow{ProjectID: 1, Scope: string(auth.ScopeWrite)}),
+		"HasProject":         returns(struct{ Exists bool }{true}),
+		"LockProject":        returns(struct{ ID int32 }{1}),
+		"DeleteProjectGoods": returns(goods...),
+		"DeleteProject":      returns(project),
+		"CreateOutboxEvent": func(args []interface{}) ([][]interface{}, error) {
+			var event struct {
+				ID        int32                `json:"id"`
+				EventType clickhouse.EventType `json:"event_type"`
+			}
+			if err := json.Unmarshal(args[1].(pgtype.JSONB).Bytes, &event); err != nil {
+				return nil, err
+			}
+			outbox = append(outbox, fmt.Sprintf("%s %d %s", args[0], event.ID, event.EventType))
+			return nil, nil
+		},
+	})
+	cache, _ := newTestCache(t)
+	r := newTestRouter(db, cache, Config{Auth: auth.NewAPIKeyAuthenticator(sqlc.New(db))})
+	header := func(key string) http.Header {
+		h := http.Header{}
+		h.Set(auth.APIKeyHeader, key)
+		return h
+	}
+
+	w := serve(r, http.MethodDelete, "/api/v1/project/remove?id=1", "10.0.0.1:1000", header("hz_writer"))
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), apperrors.ErrForbidden.Message) {
+		t.Fatalf("expected %d for a project write key, got %d: %s", http.StatusForbidden, w.Code, w.Body)
+	}
+	if len(outbox) != 0 {
+		t.Fatalf("expected no events, got %v", outbox)
+	}
+
+	w = serve(r, http.MethodDelete, "/api/v1/project/remove?id=1", "10.0.0.1:1000", header("hz_admin"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+	expected := []string{"logs.good 1 purged", "logs.good 2 purged", "logs.project 1 "}
+	if strings.Join(outbox, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected events %v, got %v", expected, outbox)
+	}
+	if !strings.Contains(w.Body.String(), `"purged":2`) {
+		t.Errorf("expected purged count, got %s", w.Body)
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yudgxe/hezzl-test/internal/apperrors"
+	"github.com/yudgxe/hezzl-test/internal/auth"
+	"github.com/yudgxe/hezzl-test/internal/tools"
+)
+
+// RateLimitConfig - лимиты запросов: с одного ip до аутентификации и на клиента, отдельно для чтения и записи.
+type RateLimitConfig struct {
+	IP    tools.RateLimit
+	Read  tools.RateLimit
+	Write tools.RateLimit
+}
+
+// ipRateLimitMiddleware - ограничивает частоту запросов с одного ip. Стоит до аутентификации,
+// чтобы перебор ключей упирался в лимит, а не в базу.
+func (e *RouterEnv) ipRateLimitMiddleware(g *gin.Context) {
+	if e.allowRate(g, "ip", "ip:"+g.ClientIP(), e.config.RateLimit.IP) {
+		g.Next()
+	}
+}
+
+// rateLimitMiddleware - ограничивает частоту запросов клиента. Клиент определяется по ключу
+// или токену, если их нет, то по ip.
+func (e *RouterEnv) rateLimitMiddleware(g *gin.Context) {
+	class, limit := string(auth.ScopeRead), e.config.RateLimit.Read
+	if methodScope(g) == auth.ScopeWrite {
+		class, limit = string(auth.ScopeWrite), e.config.RateLimit.Write
+	}
+	client := "ip:" + g.ClientIP()
+	if p := principal(g); p != nil {
+		client = p.Subject
+	}
+	if e.allowRate(g, class, client, limit) {
+		g.Next()
+	}
+}
+
+// allowRate - учитывает запрос в лимите и пишет заголовки X-RateLimit-*. При превышении пишет 429
+// в ответ и возвращает false. При недоступности редиса запросы пропускаются.
+func (e *RouterEnv) allowRate(g *gin.Context, class, client string, limit tools.RateLimit) bool {
+	if !limit.Enabled() {
+		return true
+	}
+	result, err := e.cache.AllowRate(g, class, client, limit)
+	if err != nil {
+		e.logger.Error().Err(err).Msg("failed to check rate limit")
+		return true
+	}
+
+	g.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	g.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	g.Header("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+	if !result.Allowed {
+		g.Header("Retry-After", strconv.Itoa(ceilSeconds(result.Reset)))
+		handleError(g, apperrors.ErrRateLimited.WithDetails(map[string]interface{}{
+			"limit": limit.String(),
+			"class": class,
+		}))
+		return false
+	}
+	return true
+}
+
+// ceilSeconds - длительность в целых секундах с округлением вверх, не меньше 1.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Max(1, math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/yudgxe/hezzl-test/internal/auth"
+	"github.com/yudgxe/hezzl-test/internal/database/sqlc"
+	"github.com/yudgxe/hezzl-test/internal/tools"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	cache, _ := newTestCache(t)
+	db := newFakeDB(map[string]fakeQuery{
+		"GetAPIKeyByHash": func(args []interface{}) ([][]interface{}, error) {
+			if args[0] != auth.HashAPIKey("good") {
+				return nil, nil
+			}
+			return [][]interface{}{columns(sqlc.ApiKey{ID: 1, Name: "good"})}, nil
+		},
+		"ListAPIKeyProjects": returns(),
+	})
+	r := newTestRouter(db, cache, Config{
+		Auth: auth.NewAPIKeyAuthenticator(sqlc.New(db)),
+		RateLimit: RateLimitConfig{
+			IP:   tools.RateLimit{Requests: 2, Window: time.Minute},
+			Read: tools.RateLimit{Requests: 1, Window: time.Minute},
+		},
+	})
+	header := func(key string) http.Header {
+		h := http.Header{}
+		h.Set(auth.APIKeyHeader, key)
+		return h
+	}
+
+	t.Run("ip limit before auth", func(t *testing.T) {
+		for i, expected := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests} {
+			w := serve(r, http.MethodGet, "/api/v1/projects/list", "10.0.0.1:1000", header("bad"))
+			if w.Code != expected {
+				t.Fatalf("request %d: expected %d, got %d", i+1, expected, w.Code)
+			}
+		}
+		lookups := 0
+		for _, call := range db.Calls() {
+			if call == "GetAPIKeyByHash" {
+				lookups++
+			}
+		}
+		if lookups != 2 {
+			t.Errorf("expected 2 key lookups, got %d", lookups)
+		}
+	})
+
+	t.Run("client limit after auth", func(t *testing.T) {
+		w := serve(r, http.MethodGet, "/api/v1/projects/list", "10.0.0.2:1000", header("good"))
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("expected %d, got %d", http.StatusForbidden, w.Code)
+		}
+		if w.Header().Get("X-RateLimit-Limit") != "1" || w.Header().Get("X-RateLimit-Remaining") != "0" {
+			t.Errorf("unexpected rate limit headers %v", w.Header())
+		}
+
+		w = serve(r, http.MethodGet, "/api/v1/projects/list", "10.0.0.2:1000", header("good"))
+		if w.Code != http.StatusTooManyRequests {
+			t.Fatalf("expected %d, got %d", http.StatusTooManyRequests, w.Code)
+		}
+		for name, expected := range map[string]string{
+			"X-RateLimit-Limit":     "1",
+			"X-RateLimit-Remaining": "0",
+			"X-RateLimit-Reset":     "60",
+			"Retry-After":           "60",
+		} {
+			if got := w.Header().Get(name); got != expected {
+				t.Errorf("%s: expected %q, got %q", name, expected, got)
+			}
+		}
+	})
+}
+
+func TestIPRateLimitForwardedFor(t *testing.T) {
+	db := newFakeDB(map[string]fakeQuery{"GetAPIKeyByHash": returns()})
+	limit := RateLimitConfig{IP: tools.RateLimit{Requests: 2, Window: time.Minute}}
+	tests := []struct {
+		name     string
+		proxies  []string
+		expected []int
+	}{
+		// Без доверенных прокси заголовок игнорируется, все запросы считаются с одного ip.
+		{name: "spoofed", expected: []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests}},
+		{name: "trusted proxy", proxies: []string{"10.0.0.0/8"}, expected: []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusUnauthorized}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, _ := newTestCache(t)
+			r := newTestRouter(db, cache, Config{
+				Auth:           auth.NewAPIKeyAuthenticator(sqlc.New(db)),
+				RateLimit:      limit,
+				TrustedProxies: tt.proxies,
+			})
+			for i, expected := range tt.expected {
+				header := http.Header{}
+				header.Set(auth.APIKeyHeader, "bad")
+				header.Set("X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i+1))
+				w := serve(r, http.MethodGet, "/api/v1/projects/list", "10.0.0.1:1000", header)
+				if w.Code != expected {
+					t.Fatalf("request %d: expected %d, got %d", i+1, expected, w.Code)
+				}
+			}
+		})
+	}
+}
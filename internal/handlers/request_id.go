@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yudgxe/hezzl-test/internal/model/clickhouse"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	requestIDKey    = "request_id"
+	// requestIDMaxLen - более длинный id клиента заменяется своим.
+	requestIDMaxLen = 128
+)
+
+// requestIDMiddleware - берет id запроса из X-Request-ID или генерирует новый и возвращает его в ответе.
+func requestIDMiddleware(g *gin.Context) {
+	id := g.GetHeader(requestIDHeader)
+	if id == "" || len(id) > requestIDMaxLen {
+		id = newRequestID()
+	}
+	g.Set(requestIDKey, id)
+	g.Header(requestIDHeader, id)
+	g.Next()
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// eventMeta - автор и id запроса для событий, без аутентификации автор anonymous.
+func eventMeta(g *gin.Context) clickhouse.EventMeta {
+	actor := g.GetString(subjectKey)
+	if actor == "" {
+		actor = "anonymous"
+	}
+	return clickhouse.EventMeta{
+		Actor:     actor,
+		RequestID: g.GetString(requestIDKey),
+	}
+}
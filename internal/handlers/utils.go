@@ -1,7 +1,14 @@
 package handlers
 
 import (
+	"errors"
+	"strconv"
+	"strings"
+
 	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/yudgxe/hezzl-test/internal/apperrors"
+	"github.com/yudgxe/hezzl-test/internal/tools"
 )
 
 // WebError - ошибка хендлеров.
@@ -11,6 +18,44 @@ type WebError struct {
 	Details interface{}
 }
 
+// handleError - пишет ошибку в ответ и прерывает запрос. Код, сообщение и детали берутся из каталога apperrors,
+// ошибки не из каталога отдаются как внутренние без текста исходной ошибки.
 func handleError(g *gin.Context, err error) {
-	// TODO: ставим коды, мессаджи и детали в зависимости от типа err.
+	ae := apperrors.From(err)
+	if ae.Kind == apperrors.KindInternal || ae.Kind == apperrors.KindUnavailable {
+		log.Error().Err(err).Str("method", g.Request.Method).Str("path", g.FullPath()).Msg("request failed")
+	}
+	_ = g.Error(err)
+	g.AbortWithStatusJSON(ae.Status(), WebError{Code: ae.Code, Message: ae.Message, Details: ae.Details})
+}
+
+// setETag - ставит версию записи в заголовок ETag.
+func setETag(g *gin.Context, version int32) {
+	g.Header("ETag", strconv.Quote(strconv.FormatInt(int64(version), 10)))
+}
+
+// ifMatch - проверяет подходит ли version под заголовок If-Match.
+// Пустой заголовок и * подходят под любую версию, слабые ETag (W/) не подходят никогда.
+func ifMatch(header string, version int32) bool {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return true
+	}
+	etag := strconv.Quote(strconv.FormatInt(int64(version), 10))
+	for _, v := range strings.Split(header, ",") {
+		if strings.TrimSpace(v) == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// paginationError - приводит ошибку параметров страницы к ошибке каталога.
+func paginationError(err error) error {
+	if errors.Is(err, tools.ErrLimitTooLarge) {
+		return apperrors.ErrValidation.Wrap(err).WithDetails([]apperrors.FieldError{
+			{Field: "limit", Reason: "max", Param: strconv.Itoa(tools.PaginationMaxLimit)},
+		})
+	}
+	return apperrors.ErrInvalidCursor.Wrap(err)
 }
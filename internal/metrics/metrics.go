@@ -0,0 +1,103 @@
+// Package metrics - метрики prometheus. Имена метрик и меток - часть api для дашбордов,
+// их список есть в README, менять только вместе с ним.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "hezzl"
+
+// Registry - реестр всех метрик сервиса, включая метрики рантайма go и процесса.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests - количество запросов по методу, шаблону пути gin и статусу ответа.
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests by method, gin route and status.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPRequestDuration - время обработки запросов по методу, шаблону пути gin и статусу ответа.
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by method, gin route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// CacheLookups - попадания и промахи кеша, result - hit или miss.
+	CacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "lookups_total",
+		Help:      "Cache lookups by operation and result (hit or miss).",
+	}, []string{"operation", "result"})
+
+	// WorkerBuffered - сколько сообщений воркер держит в памяти и еще не отправил.
+	WorkerBuffered = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "worker",
+		Name:      "buffered_messages",
+		Help:      "Messages buffered by the worker and not sent yet.",
+	}, []string{"subject"})
+
+	// WorkerBatches - отправленные пачки, result - ok или error.
+	WorkerBatches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "worker",
+		Name:      "batches_total",
+		Help:      "Batches sent by the worker by result (ok or error).",
+	}, []string{"subject", "result"})
+
+	// WorkerMessages - сообщения в отправленных пачках, result - ok или error.
+	WorkerMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "worker",
+		Name:      "messages_total",
+		Help:      "Messages in batches sent by the worker by result (ok or error).",
+	}, []string{"subject", "result"})
+
+	// WorkerBatchDuration - время отправки пачки, включая повторы.
+	WorkerBatchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "worker",
+		Name:      "batch_duration_seconds",
+		Help:      "Time to send a batch, including retries.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"subject"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		CacheLookups,
+		WorkerBuffered,
+		WorkerBatches,
+		WorkerMessages,
+		WorkerBatchDuration,
+	)
+}
+
+// Handler - http хендлер для /metrics.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Result - значение метки result по ошибке.
+func Result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
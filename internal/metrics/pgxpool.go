@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var _ prometheus.Collector = (*PoolCollector)(nil)
+
+// PoolCollector - статистика пула соединений pgxpool, снимается при каждом сборе метрик.
+type PoolCollector struct {
+	pool *pgxpool.Pool
+
+	acquireCount         *prometheus.Desc
+	acquireDuration      *prometheus.Desc
+	canceledAcquireCount *prometheus.Desc
+	emptyAcquireCount    *prometheus.Desc
+	acquiredConns        *prometheus.Desc
+	constructingConns    *prometheus.Desc
+	idleConns            *prometheus.Desc
+	totalConns           *prometheus.Desc
+	maxConns             *prometheus.Desc
+}
+
+func NewPoolCollector(pool *pgxpool.Pool) *PoolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "pgxpool", name), help, nil, nil)
+	}
+	return &PoolCollector{
+		pool:                 pool,
+		acquireCount:         desc("acquires_total", "Successful connection acquires from the pool."),
+		acquireDuration:      desc("acquire_duration_seconds_total", "Total time spent acquiring connections from the pool."),
+		canceledAcquireCount: desc("canceled_acquires_total", "Acquires canceled by context."),
+		emptyAcquireCount:    desc("empty_acquires_total", "Successful acquires that had to wait for a connection."),
+		acquiredConns:        desc("acquired_connections", "Connections currently acquired."),
+		constructingConns:    desc("constructing_connections", "Connections currently being established."),
+		idleConns:            desc("idle_connections", "Idle connections in the pool."),
+		totalConns:           desc("total_connections", "Total connections in the pool."),
+		maxConns:             desc("max_connections", "Maximum size of the pool."),
+	}
+}
+
+func (c *PoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.acquireCount
+	ch <- c.acquireDuration
+	ch <- c.canceledAcquireCount
+	ch <- c.emptyAcquireCount
+	ch <- c.acquiredConns
+	ch <- c.constructingConns
+	ch <- c.idleConns
+	ch <- c.totalConns
+	ch <- c.maxConns
+}
+
+func (c *PoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(c.acquireCount, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.canceledAcquireCount, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquireCount, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.constructingConns, prometheus.GaugeValue, float64(stat.ConstructingConns()))
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.maxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+}
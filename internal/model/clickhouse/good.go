@@ -6,14 +6,53 @@ import (
 	"github.com/yudgxe/hezzl-test/internal/database/sqlc"
 )
 
+// EventType - что произошло с товаром.
+type EventType string
+
+const (
+	EventCreated       EventType = "created"
+	EventUpdated       EventType = "updated"
+	EventRemoved       EventType = "removed"
+	EventRestored      EventType = "restored"
+	EventReprioritized EventType = "reprioritized"
+	EventPurged        EventType = "purged"
+)
+
+// EventMeta - кто и в каком запросе изменил запись.
+type EventMeta struct {
+	Actor     string
+	RequestID string
+}
+
+// Good - событие товара, теги ch - колонки таблицы logs.goods.
 type Good struct {
-	sqlc.Good
-	EventTime time.Time
+	ID          int32     `json:"id" ch:"id"`
+	ProjectID   int32     `json:"project_id" ch:"project_id"`
+	Name        string    `json:"name" ch:"name"`
+	Description string    `json:"description" ch:"description"`
+	Priority    int64     `json:"priority" ch:"priority"`
+	Removed     bool      `json:"removed" ch:"removed"`
+	CreatedAt   time.Time `json:"created_at" ch:"created_at"`
+	Version     int32     `json:"version" ch:"-"`
+	EventType   EventType `json:"event_type" ch:"event_type"`
+	Actor       string    `json:"actor" ch:"actor"`
+	RequestID   string    `json:"request_id" ch:"request_id"`
+	EventTime   time.Time `json:"event_time" ch:"event_time"`
 }
 
-func FromGoodSQLC(good sqlc.Good) Good {
+func FromGoodSQLC(good sqlc.Good, eventType EventType, meta EventMeta) Good {
 	return Good{
-		Good:      good,
-		EventTime: time.Now(),
+		ID:          good.ID,
+		ProjectID:   good.ProjectID,
+		Name:        good.Name,
+		Description: good.Description.String,
+		Priority:    int64(good.Priority),
+		Removed:     good.Removed,
+		CreatedAt:   good.CreatedAt,
+		Version:     good.Version,
+		EventType:   eventType,
+		Actor:       meta.Actor,
+		RequestID:   meta.RequestID,
+		EventTime:   time.Now(),
 	}
 }
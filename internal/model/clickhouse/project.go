@@ -0,0 +1,24 @@
+package clickhouse
+
+import (
+	"time"
+
+	"github.com/yudgxe/hezzl-test/internal/database/sqlc"
+)
+
+// Project - событие проекта в теме logs.project, в clickhouse не пишется.
+type Project struct {
+	ID        int32     `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	EventTime time.Time `json:"event_time"`
+}
+
+func FromProjectSQLC(project sqlc.Project) Project {
+	return Project{
+		ID:        project.ID,
+		Name:      project.Name,
+		CreatedAt: project.CreatedAt,
+		EventTime: time.Now(),
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog/log"
 	"github.com/yudgxe/hezzl-test/internal/database/sqlc"
+	"github.com/yudgxe/hezzl-test/internal/metrics"
 	"golang.org/x/net/context"
 )
 
@@ -47,7 +48,7 @@ func (c *Cache) ScanKey(ctx context.Context, match string) (string, bool, error)
 	var err error
 
 	for {
-		keys, cursor, err = c.Scan(context.Background(), cursor, match, 0).Result()
+		keys, cursor, err = c.Scan(ctx, cursor, match, 0).Result()
 		if err != nil {
 			return "", false, err
 		}
@@ -61,21 +62,60 @@ func (c *Cache) ScanKey(ctx context.Context, match string) (string, bool, error)
 	return "", false, nil
 }
 
+// goodKey - ключ товара вне пагинации, разделитель отличается, чтобы ключ не попадал под маски вида *:*:position.
+func goodKey(id, projectID int32) string {
+	return fmt.Sprintf("good_%d_%d", id, projectID)
+}
+
 func (c *Cache) SetGood(ctx context.Context, good sqlc.Good, expiration time.Duration, ifexist bool) error {
+	if err := c.setGood(ctx, goodKey(good.ID, good.ProjectID), good, expiration, ifexist); err != nil {
+		return err
+	}
 	return c.setGood(ctx, fmt.Sprintf("%d:%d:*", good.ID, good.ProjectID), good, expiration, ifexist)
 }
 
-func (c *Cache) SetGoodWihtPagination(ctx context.Context, good sqlc.Good, expiration time.Duration, ifexist bool, pagination int) error {
-	return c.setGood(ctx, fmt.Sprintf("%d:%d:%d", good.ID, good.ProjectID, pagination), good, expiration, ifexist)
+// SetGoods - то же, что SetGood, но для нескольких товаров.
+func (c *Cache) SetGoods(ctx context.Context, goods []sqlc.Good, expiration time.Duration, ifexist bool) error {
+	for _, good := range goods {
+		if err := c.SetGood(ctx, good, expiration, ifexist); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Cache) SetGoodWithID(ctx context.Context, good sqlc.Good, expiration time.Duration) error {
+	return c.setGood(ctx, goodKey(good.ID, good.ProjectID), good, expiration, false)
+}
+
+// GetGood - возвращает товар из кеша, ok = false если товара в кеше нет.
+func (c *Cache) GetGood(ctx context.Context, id, projectID int32) (sqlc.Good, bool, error) {
+	var good sqlc.Good
+	if err := c.getStruct(ctx, goodKey(id, projectID), &good); err != nil {
+		if err == redis.Nil {
+			return good, false, nil
+		}
+		return good, false, err
+	}
+	log.Info().Interface("good", good).Msg("get cash")
+	return good, true, nil
+}
+
+// SetGoodWihtPagination - сохраняет товар по позиции в списке, ключ имеет вид id:project_id:scope:position.
+// Scope - проект по которому строился список, 0 - список по всем проектам,
+// так позиции из списков разных проектов не пересекаются.
+func (c *Cache) SetGoodWihtPagination(ctx context.Context, good sqlc.Good, expiration time.Duration, ifexist bool, scope int32, pagination int) error {
+	return c.setGood(ctx, fmt.Sprintf("%d:%d:%d:%d", good.ID, good.ProjectID, scope, pagination), good, expiration, ifexist)
 }
 
 func (c *Cache) setGood(ctx context.Context, key string, good sqlc.Good, expiration time.Duration, ifexist bool) error {
 	if ifexist {
-		gk, ok, err := c.ScanKey(ctx, key)
+		// Товар может лежать в кеше сразу в нескольких списках, обновляем все.
+		keys, err := c.scanKeys(ctx, key)
 		if err != nil {
 			return err
 		}
-		if ok {
+		for _, gk := range keys {
 			if err := c.setStruct(ctx, gk, good, expiration); err != nil {
 				return err
 			}
@@ -97,18 +137,27 @@ type GetGoodsWithPaginationReponse struct {
 	hasNotFound bool
 }
 
+// NoCacheGoodsWithPagination - ответ, в котором ни один товар не найден в кеше, для списков, которые не кешируются.
+func NoCacheGoodsWithPagination(pagination Pagination) *GetGoodsWithPaginationReponse {
+	return &GetGoodsWithPaginationReponse{
+		pagination:  pagination,
+		hasNotFound: true,
+	}
+}
+
 func (ggwpr *GetGoodsWithPaginationReponse) HasNotFound() bool { return ggwpr.hasNotFound }
 
 func (ggwpr *GetGoodsWithPaginationReponse) MergeIndex() int { return ggwpr.mergeIndex }
 
 func (ggwpr *GetGoodsWithPaginationReponse) Pagination() Pagination { return ggwpr.pagination }
 
-func (c *Cache) GetGoodsWithPagination(ctx context.Context, pagination Pagination) ([]sqlc.Good, *GetGoodsWithPaginationReponse, error) {
+// GetGoodsWithPagination - ищет в кеше товары списка scope (0 - все проекты) по их позициям.
+func (c *Cache) GetGoodsWithPagination(ctx context.Context, scope int32, pagination Pagination) ([]sqlc.Good, *GetGoodsWithPaginationReponse, error) {
 	var good sqlc.Good
 	nf := make([]int, 0)
 	response := make([]sqlc.Good, 0)
 	for i := pagination.Offset + 1; i < pagination.Offset+pagination.Limit+1; i++ {
-		key, ok, err := c.ScanKey(context.Background(), fmt.Sprintf("*:*:%d", i))
+		key, ok, err := c.ScanKey(ctx, fmt.Sprintf("*:*:%d:%d", scope, i))
 		if err != nil {
 			log.Printf("%s\n", err)
 		}
@@ -127,6 +176,9 @@ func (c *Cache) GetGoodsWithPagination(ctx context.Context, pagination Paginatio
 		}
 
 	}
+	metrics.CacheLookups.WithLabelValues("goods_with_pagination", "hit").Add(float64(len(response)))
+	metrics.CacheLookups.WithLabelValues("goods_with_pagination", "miss").Add(float64(len(nf)))
+
 	ggwpr := new(GetGoodsWithPaginationReponse)
 	// Ставим новый offset и limit.
 	// Пример: offset = 5, limit = 5 -> необходимо найти товары с offset'ом [6, 7, 8, 9, 10].
@@ -143,3 +195,211 @@ func (c *Cache) GetGoodsWithPagination(ctx context.Context, pagination Paginatio
 
 	return response, ggwpr, nil
 }
+
+// goodsPageKey - ключ страницы списка в режиме курсора.
+func goodsPageKey(scope int32, cursor string, limit int) string {
+	return fmt.Sprintf("cursor:%d:%d:%s", scope, limit, cursor)
+}
+
+type goodRef struct {
+	ID        int32 `json:"id"`
+	ProjectID int32 `json:"project_id"`
+}
+
+type goodsPage struct {
+	Goods      []goodRef `json:"goods"`
+	NextCursor string    `json:"next_cursor"`
+}
+
+// SetGoodsPage - сохраняет страницу списка полученную по курсору.
+// Сама страница хранит только ссылки на товары, сами товары лежат под ключами товаров и
+// обновляются вместе с ними, поэтому страница остается валидной при изменении товаров.
+func (c *Cache) SetGoodsPage(ctx context.Context, scope int32, cursor string, limit int, goods []sqlc.Good, next string, expiration time.Duration) error {
+	page := goodsPage{
+		Goods:      make([]goodRef, 0, len(goods)),
+		NextCursor: next,
+	}
+	for _, good := range goods {
+		if err := c.SetGoodWithID(ctx, good, expiration); err != nil {
+			return err
+		}
+		page.Goods = append(page.Goods, goodRef{ID: good.ID, ProjectID: good.ProjectID})
+	}
+	return c.setStruct(ctx, goodsPageKey(scope, cursor, limit), page, expiration)
+}
+
+// GetGoodsPage - возвращает страницу списка по курсору, ok = false если страницы
+// или хотя бы одного товара из нее нет в кеше.
+func (c *Cache) GetGoodsPage(ctx context.Context, scope int32, cursor string, limit int) ([]sqlc.Good, string, bool, error) {
+	var page goodsPage
+	if err := c.getStruct(ctx, goodsPageKey(scope, cursor, limit), &page); err != nil {
+		if err == redis.Nil {
+			return nil, "", false, nil
+		}
+		return nil, "", false, err
+	}
+	response := make([]sqlc.Good, 0, len(page.Goods))
+	for _, ref := range page.Goods {
+		good, ok, err := c.GetGood(ctx, ref.ID, ref.ProjectID)
+		if err != nil || !ok {
+			return nil, "", false, err
+		}
+		response = append(response, good)
+	}
+	return response, page.NextCursor, true, nil
+}
+
+// DelGoodsPages - удаляет все страницы списков по курсору, нужно при физическом удалении товаров.
+func (c *Cache) DelGoodsPages(ctx context.Context) error {
+	return c.delByMatch(ctx, "cursor:*")
+}
+
+func projectKey(id int32) string {
+	return fmt.Sprintf("project:%d", id)
+}
+
+func (c *Cache) SetProject(ctx context.Context, project sqlc.Project, expiration time.Duration) error {
+	if err := c.setStruct(ctx, projectKey(project.ID), project, expiration); err != nil {
+		return err
+	}
+	log.Info().Interface("project", project).Msg("set cash")
+	return nil
+}
+
+// GetProject - возвращает проект из кеша, ok = false если проекта в кеше нет.
+func (c *Cache) GetProject(ctx context.Context, id int32) (sqlc.Project, bool, error) {
+	var project sqlc.Project
+	if err := c.getStruct(ctx, projectKey(id), &project); err != nil {
+		if err == redis.Nil {
+			return project, false, nil
+		}
+		return project, false, err
+	}
+	log.Info().Interface("project", project).Msg("get cash")
+	return project, true, nil
+}
+
+// DelProject - удаляет проект и все его товары из кеша.
+func (c *Cache) DelProject(ctx context.Context, id int32) error {
+	if err := c.Del(ctx, projectKey(id)).Err(); err != nil {
+		return err
+	}
+
+	for _, match := range []string{fmt.Sprintf("*:%d:*", id), fmt.Sprintf("good_*_%d", id), "cursor:*"} {
+		if err := c.delByMatch(ctx, match); err != nil {
+			return err
+		}
+	}
+	log.Info().Int32("project_id", id).Msg("deleted cash")
+	return nil
+}
+
+// DelGoods - удаляет товары из кеша. Позиции остальных товаров в списках сдвигаются,
+// поэтому вместе с товарами удаляются закешированные списки их проектов и общий список.
+func (c *Cache) DelGoods(ctx context.Context, goods []sqlc.Good) error {
+	matches := []string{"*:*:0:*", "cursor:*"}
+	projects := make(map[int32]struct{})
+	for _, good := range goods {
+		if _, ok := projects[good.ProjectID]; !ok {
+			projects[good.ProjectID] = struct{}{}
+			matches = append(matches, fmt.Sprintf("*:*:%d:*", good.ProjectID))
+		}
+		matches = append(matches, goodKey(good.ID, good.ProjectID))
+	}
+	for _, match := range matches {
+		if err := c.delByMatch(ctx, match); err != nil {
+			return err
+		}
+	}
+	log.Info().Int("count", len(goods)).Msg("deleted cash")
+	return nil
+}
+
+// DelCached - удаляет из кеша все товары, списки и проекты. Ключи идемпотентности и лимитов
+// запросов остаются, они не зависят от данных в базе.
+func (c *Cache) DelCached(ctx context.Context) error {
+	for _, match := range []string{"good_*", "[0-9]*:*:*:*", "cursor:*", "project:*"} {
+		if err := c.delByMatch(ctx, match); err != nil {
+			return err
+		}
+	}
+	log.Info().Msg("deleted all cash")
+	return nil
+}
+
+// delByMatch - удаляет все ключи подходящие под match.
+func (c *Cache) delByMatch(ctx context.Context, match string) error {
+	keys, err := c.scanKeys(ctx, match)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return c.Del(ctx, keys...).Err()
+}
+
+// scanKeys - возвращает все ключи подходящие под match.
+func (c *Cache) scanKeys(ctx context.Context, match string) ([]string, error) {
+	var cursor uint64
+	var keys []string
+	var err error
+
+	response := make([]string, 0)
+	for {
+		keys, cursor, err = c.Scan(ctx, cursor, match, 0).Result()
+		if err != nil {
+			return nil, err
+		}
+		response = append(response, keys...)
+		if cursor == 0 {
+			break
+		}
+	}
+	return response, nil
+}
+
+// IdempotentResponse - сохраненный ответ на запрос с Idempotency-Key.
+type IdempotentResponse struct {
+	// Hash - хеш тела запроса, под одним ключом можно повторить только тот же запрос.
+	Hash string `json:"hash"`
+	// Pending - запрос с этим ключом еще выполняется.
+	Pending bool            `json:"pending"`
+	Status  int             `json:"status"`
+	ETag    string          `json:"etag"`
+	Body    json.RawMessage `json:"body"`
+}
+
+func idempotencyKey(scope, key string) string {
+	return fmt.Sprintf("idempotency_%s_%s", scope, key)
+}
+
+// ReserveIdempotencyKey - занимает ключ под выполнение запроса, false если ключ уже занят.
+func (c *Cache) ReserveIdempotencyKey(ctx context.Context, scope, key, hash string, expiration time.Duration) (bool, error) {
+	b, err := json.Marshal(IdempotentResponse{Hash: hash, Pending: true})
+	if err != nil {
+		return false, err
+	}
+	return c.SetNX(ctx, idempotencyKey(scope, key), b, expiration).Result()
+}
+
+// GetIdempotencyKey - возвращает сохраненный ответ, ok = false если ключа нет.
+func (c *Cache) GetIdempotencyKey(ctx context.Context, scope, key string) (IdempotentResponse, bool, error) {
+	var response IdempotentResponse
+	if err := c.getStruct(ctx, idempotencyKey(scope, key), &response); err != nil {
+		if err == redis.Nil {
+			return response, false, nil
+		}
+		return response, false, err
+	}
+	return response, true, nil
+}
+
+func (c *Cache) SetIdempotencyKey(ctx context.Context, scope, key string, response IdempotentResponse, expiration time.Duration) error {
+	return c.setStruct(ctx, idempotencyKey(scope, key), response, expiration)
+}
+
+// DelIdempotencyKey - освобождает ключ, если запрос не удался и его можно повторить.
+func (c *Cache) DelIdempotencyKey(ctx context.Context, scope, key string) error {
+	return c.Del(ctx, idempotencyKey(scope, key)).Err()
+}
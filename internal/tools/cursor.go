@@ -0,0 +1,72 @@
+package tools
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor - позиция в списке для постраничного вывода по ключу (keyset pagination).
+// Клиенту отдается в виде непрозрачной строки.
+type Cursor struct {
+	// ID - id последнего товара на предыдущей странице.
+	ID int32 `json:"id"`
+}
+
+// Encode - кодирует курсор в непрозрачную строку.
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor - декодирует курсор, пустая строка - начало списка.
+func DecodeCursor(s string) (Cursor, error) {
+	var c Cursor
+	if s == "" {
+		return c, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+type CursorPagination struct {
+	Limit  int
+	Cursor Cursor
+}
+
+// GetCursorPagination - возвращает CursorPagination, если в запросе передан cursor (в том числе пустой).
+// ok = false - клиент работает в режиме limit/offset. Limit больше PaginationMaxLimit - ошибка ErrLimitTooLarge.
+func GetCursorPagination(g *gin.Context) (CursorPagination, bool, error) {
+	raw, ok := g.GetQuery("cursor")
+	if !ok {
+		return CursorPagination{}, false, nil
+	}
+	cursor, err := DecodeCursor(raw)
+	if err != nil {
+		return CursorPagination{}, true, err
+	}
+	p := CursorPagination{
+		Limit:  paginationDefaultLimit,
+		Cursor: cursor,
+	}
+	var q struct {
+		Limit int `form:"limit"`
+	}
+	if g.ShouldBindQuery(&q) == nil && q.Limit > 0 {
+		p.Limit = q.Limit
+	}
+	if p.Limit > PaginationMaxLimit {
+		return CursorPagination{}, true, ErrLimitTooLarge
+	}
+	return p, true, nil
+}
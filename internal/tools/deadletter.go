@@ -0,0 +1,143 @@
+package tools
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// DeadLetter - куда складываются пачки, которые не удалось отправить.
+type DeadLetter interface {
+	Put(batch interface{}, err error) error
+}
+
+// DeadLetterRecord - сохраненная пачка.
+type DeadLetterRecord struct {
+	Error    string          `json:"error"`
+	FailedAt time.Time       `json:"failed_at"`
+	Items    json.RawMessage `json:"items"`
+}
+
+func newDeadLetterRecord(batch interface{}, err error) ([]byte, error) {
+	items, mErr := json.Marshal(batch)
+	if mErr != nil {
+		return nil, mErr
+	}
+	return json.Marshal(DeadLetterRecord{
+		Error:    err.Error(),
+		FailedAt: time.Now(),
+		Items:    items,
+	})
+}
+
+const deadLetterFileExt = ".json"
+
+var _ DeadLetter = (*FileDeadLetter)(nil)
+
+// FileDeadLetter - складывает пачки в отдельные файлы в каталоге.
+type FileDeadLetter struct {
+	dir string
+}
+
+func NewFileDeadLetter(dir string) (*FileDeadLetter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileDeadLetter{
+		dir: dir,
+	}, nil
+}
+
+func (d *FileDeadLetter) Put(batch interface{}, err error) error {
+	data, mErr := newDeadLetterRecord(batch, err)
+	if mErr != nil {
+		return mErr
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+	// Пишем во временный файл и переименовываем, чтобы replay не прочитал файл наполовину.
+	tmp := filepath.Join(d.dir, "."+name)
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(d.dir, name+deadLetterFileExt))
+}
+
+// Files - сохраненные пачки от старых к новым.
+func (d *FileDeadLetter) Files() ([]string, error) {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || filepath.Ext(name) != deadLetterFileExt {
+			continue
+		}
+		files = append(files, filepath.Join(d.dir, name))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+var _ DeadLetter = (*NATSDeadLetter)(nil)
+
+// NATSDeadLetter - публикует пачки в тему nats. Тема должна попадать в стрим JetStream,
+// иначе без подписчиков пачки потеряются.
+type NATSDeadLetter struct {
+	js      nats.JetStreamContext
+	subject string
+}
+
+func NewNATSDeadLetter(js nats.JetStreamContext, subject string) *NATSDeadLetter {
+	return &NATSDeadLetter{
+		js:      js,
+		subject: subject,
+	}
+}
+
+func (d *NATSDeadLetter) Put(batch interface{}, err error) error {
+	data, mErr := newDeadLetterRecord(batch, err)
+	if mErr != nil {
+		return mErr
+	}
+	_, err = d.js.Publish(d.subject, data)
+	return err
+}
+
+const (
+	// DeadLetterStream - стрим для пачек, которые не удалось отправить.
+	DeadLetterStream = "DEADLETTER"
+	// DeadLetterSubjectPrefix - префикс тем DeadLetterStream.
+	DeadLetterSubjectPrefix = "deadletter."
+)
+
+// EnsureDeadLetterStream - создает стрим для NATSDeadLetter, если его еще нет.
+func EnsureDeadLetterStream(js nats.JetStreamContext) error {
+	_, err := js.StreamInfo(DeadLetterStream)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, nats.ErrStreamNotFound) {
+		return err
+	}
+	_, err = js.AddStream(&nats.StreamConfig{
+		Name:     DeadLetterStream,
+		Subjects: []string{DeadLetterSubjectPrefix + ">"},
+		Storage:  nats.FileStorage,
+	})
+	return err
+}
@@ -0,0 +1,101 @@
+package tools
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// HealthStatus - состояние сервиса или отдельной зависимости.
+type HealthStatus string
+
+const (
+	HealthUp   HealthStatus = "up"
+	HealthDown HealthStatus = "down"
+	// HealthDegraded - недоступна некритичная зависимость, сервис продолжает работать.
+	HealthDegraded HealthStatus = "degraded"
+)
+
+// HealthCheck - проверка одной зависимости.
+type HealthCheck struct {
+	Name string
+	// Critical - без зависимости сервис не может обслуживать запросы.
+	Critical bool
+	Check    func(ctx context.Context) error
+}
+
+// HealthCheckResult - результат проверки одной зависимости.
+type HealthCheckResult struct {
+	Status   HealthStatus `json:"status"`
+	Critical bool         `json:"critical"`
+	Duration string       `json:"duration"`
+	Error    string       `json:"error,omitempty"`
+}
+
+// HealthReport - результат проверки всех зависимостей.
+type HealthReport struct {
+	Status HealthStatus                 `json:"status"`
+	Checks map[string]HealthCheckResult `json:"checks"`
+}
+
+// HealthChecker - проверяет зависимости параллельно, каждую со своим таймаутом.
+type HealthChecker struct {
+	checks  []HealthCheck
+	timeout time.Duration
+}
+
+func NewHealthChecker(timeout time.Duration, checks ...HealthCheck) *HealthChecker {
+	return &HealthChecker{
+		checks:  checks,
+		timeout: timeout,
+	}
+}
+
+// Check - проверяет все зависимости. Если недоступна критичная зависимость, то статус down,
+// если только некритичные - degraded.
+func (h *HealthChecker) Check(ctx context.Context) HealthReport {
+	report := HealthReport{
+		Status: HealthUp,
+		Checks: make(map[string]HealthCheckResult, len(h.checks)),
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range h.checks {
+		wg.Add(1)
+		go func(check HealthCheck) {
+			defer wg.Done()
+			result := h.run(ctx, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[check.Name] = result
+			switch {
+			case result.Status == HealthUp:
+			case check.Critical:
+				report.Status = HealthDown
+			case report.Status == HealthUp:
+				report.Status = HealthDegraded
+			}
+		}(check)
+	}
+	wg.Wait()
+	return report
+}
+
+func (h *HealthChecker) run(ctx context.Context, check HealthCheck) HealthCheckResult {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Check(ctx)
+	result := HealthCheckResult{
+		Status:   HealthUp,
+		Critical: check.Critical,
+		Duration: time.Since(start).Round(time.Microsecond).String(),
+	}
+	if err != nil {
+		result.Status = HealthDown
+		result.Error = err.Error()
+	}
+	return result
+}
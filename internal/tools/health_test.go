@@ -0,0 +1,69 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHealthChecker(t *testing.T) {
+	up := func(context.Context) error { return nil }
+	down := func(context.Context) error { return errors.New("connection refused") }
+	hang := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	tests := []struct {
+		name     string
+		checks   []HealthCheck
+		expected HealthStatus
+	}{
+		{
+			name: "all up",
+			checks: []HealthCheck{
+				{Name: "postgres", Critical: true, Check: up},
+				{Name: "redis", Check: up},
+			},
+			expected: HealthUp,
+		},
+		{
+			name: "optional down",
+			checks: []HealthCheck{
+				{Name: "postgres", Critical: true, Check: up},
+				{Name: "redis", Check: down},
+			},
+			expected: HealthDegraded,
+		},
+		{
+			name: "critical timeout",
+			checks: []HealthCheck{
+				{Name: "postgres", Critical: true, Check: hang},
+				{Name: "redis", Check: down},
+			},
+			expected: HealthDown,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			report := NewHealthChecker(50*time.Millisecond, tt.checks...).Check(context.Background())
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Fatalf("checks took %s, expected timeout to apply", elapsed)
+			}
+			if report.Status != tt.expected {
+				t.Fatalf("expected status %s, got %s", tt.expected, report.Status)
+			}
+			if len(report.Checks) != len(tt.checks) {
+				t.Fatalf("expected %d checks, got %d", len(tt.checks), len(report.Checks))
+			}
+			for _, check := range tt.checks {
+				result := report.Checks[check.Name]
+				if (result.Status == HealthDown) != (result.Error != "") {
+					t.Errorf("%s: status %s with error %q", check.Name, result.Status, result.Error)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+	"github.com/yudgxe/hezzl-test/internal/metrics"
+	"github.com/yudgxe/hezzl-test/internal/tracing"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// LogsStream - стрим со всеми логами.
+	LogsStream = "LOGS"
+	// logsStreamSubjects - темы, которые попадают в LogsStream.
+	logsStreamSubjects = "logs.>"
+	// logsStreamDuplicates - окно, в котором JetStream отбрасывает повторы по Nats-Msg-Id.
+	logsStreamDuplicates = 10 * time.Minute
+	// logsStreamMaxAge - сколько стрим хранит сообщения, в том числе темы, которые никто не читает.
+	logsStreamMaxAge = 7 * 24 * time.Hour
+	// jetStreamNakDelay - через сколько повторить доставку пачки, которую не удалось отправить.
+	jetStreamNakDelay = 5 * time.Second
+)
+
+// EnsureLogsStream - создает стрим логов, если его еще нет.
+func EnsureLogsStream(js nats.JetStreamContext) error {
+	_, err := js.StreamInfo(LogsStream)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, nats.ErrStreamNotFound) {
+		return err
+	}
+	_, err = js.AddStream(&nats.StreamConfig{
+		Name:       LogsStream,
+		Subjects:   []string{logsStreamSubjects},
+		Storage:    nats.FileStorage,
+		Duplicates: logsStreamDuplicates,
+		MaxAge:     logsStreamMaxAge,
+	})
+	return err
+}
+
+// JetStreamWorker - как Worker, но читает из durable pull consumer JetStream,
+// поэтому события, пришедшие пока воркер не работал, не теряются.
+// Сообщения подтверждаются только после успешной отправки пачки, иначе JetStream доставит их заново.
+// Пока пачка отправляется с повторами, воркер продлевает AckWait ее сообщений через InProgress.
+type JetStreamWorker[T any] struct {
+	sender        Sender[T]
+	js            nats.JetStreamContext
+	durable       string
+	batchSize     int
+	flushInterval time.Duration
+	// subject - тема nats, метка метрик воркера.
+	subject string
+	// ackWait - AckWait consumer, за это время пачку нужно подтвердить или продлить.
+	ackWait time.Duration
+
+	cancel context.CancelFunc
+	// sendCtx - контекст отправки, отменяется, если Stop не дождался отправки текущей пачки.
+	sendCtx    context.Context
+	sendCancel context.CancelFunc
+	done       chan struct{}
+}
+
+func NewJetStreamWorker[T any](js nats.JetStreamContext, durable string, sender Sender[T], batchSize int, flushInterval time.Duration) *JetStreamWorker[T] {
+	sendCtx, sendCancel := context.WithCancel(context.Background())
+	return &JetStreamWorker[T]{
+		sender:        sender,
+		js:            js,
+		durable:       durable,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		sendCtx:       sendCtx,
+		sendCancel:    sendCancel,
+		done:          make(chan struct{}),
+	}
+}
+
+func (w *JetStreamWorker[T]) Start(subject string) error {
+	sub, err := w.js.PullSubscribe(subject, w.durable, nats.BindStream(LogsStream), nats.ManualAck())
+	if err != nil {
+		return err
+	}
+	info, err := sub.ConsumerInfo()
+	if err != nil {
+		return err
+	}
+	w.ackWait = info.Config.AckWait
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+	w.subject = subject
+	go w.run(ctx, sub)
+	return nil
+}
+
+func (w *JetStreamWorker[T]) run(ctx context.Context, sub *nats.Subscription) {
+	defer close(w.done)
+	for ctx.Err() == nil {
+		// Fetch ждет не дольше flushInterval, так неполная пачка тоже уходит по времени.
+		msgs, err := sub.Fetch(w.batchSize, nats.MaxWait(w.flushInterval))
+		if err != nil && !errors.Is(err, nats.ErrTimeout) {
+			log.Error().Err(err).Msg("failed to fetch")
+			select {
+			case <-ctx.Done():
+			case <-time.After(w.flushInterval):
+			}
+			continue
+		}
+		w.handle(msgs)
+	}
+}
+
+// handle - отправляет пачку и подтверждает ее, при ошибке просит доставить заново.
+func (w *JetStreamWorker[T]) handle(msgs []*nats.Msg) {
+	if len(msgs) == 0 {
+		return
+	}
+	batch := make([]T, 0, len(msgs))
+	acked := make([]*nats.Msg, 0, len(msgs))
+	links := make([]trace.Link, 0, len(msgs))
+	for _, msg := range msgs {
+		var in T
+		if err := json.Unmarshal(msg.Data, &in); err != nil {
+			// Битое сообщение не исправится при повторе.
+			log.Error().Err(err).Str("subject", msg.Subject).Msg("failed to decode, dropping")
+			if err := msg.Term(); err != nil {
+				log.Error().Err(err).Msg("failed to term")
+			}
+			continue
+		}
+		batch = append(batch, in)
+		acked = append(acked, msg)
+		links = append(links, tracing.LinkNATS(msg))
+	}
+	if len(batch) == 0 {
+		return
+	}
+
+	buffered := metrics.WorkerBuffered.WithLabelValues(w.subject)
+	buffered.Set(float64(len(batch)))
+	defer buffered.Set(0)
+
+	stop := w.inProgress(acked)
+	err := sendBatch(w.sendCtx, w.sender, w.subject, batch, links)
+	stop()
+	if err != nil {
+		log.Error().Err(err).Int("count", len(batch)).Msg("failed to send, will be redelivered")
+		for _, msg := range acked {
+			if err := msg.NakWithDelay(jetStreamNakDelay); err != nil {
+				log.Error().Err(err).Msg("failed to nak")
+			}
+		}
+		return
+	}
+	for _, msg := range acked {
+		if err := msg.Ack(); err != nil {
+			log.Error().Err(err).Msg("failed to ack")
+		}
+	}
+}
+
+// inProgress - пока пачка отправляется, периодически сообщает JetStream, что ее сообщения
+// еще обрабатываются, иначе после AckWait они будут доставлены заново во время повторов.
+// Возвращает функцию, которая останавливает продление.
+func (w *JetStreamWorker[T]) inProgress(msgs []*nats.Msg) func() {
+	if w.ackWait <= 0 {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(w.ackWait / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				for _, msg := range msgs {
+					if err := msg.InProgress(); err != nil {
+						log.Error().Err(err).Msg("failed to extend ack wait")
+					}
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-stopped
+	}
+}
+
+// Stop - дожидается отправки текущей пачки. Если ctx закончится раньше, повторы отправки
+// прерываются и пачка уходит в DeadLetter RetrySender. Неподтвержденные сообщения останутся в JetStream.
+func (w *JetStreamWorker[T]) Stop(ctx context.Context) error {
+	if w.cancel == nil {
+		return nil
+	}
+	w.cancel()
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		w.sendCancel()
+		<-w.done
+		return ctx.Err()
+	}
+}
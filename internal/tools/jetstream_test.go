@@ -0,0 +1,172 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	natstest "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+)
+
+// jetStreamTest - встроенный сервер nats с JetStream во временной папке.
+func jetStreamTest(t *testing.T) nats.JetStreamContext {
+	opts := natstest.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+	srv := natstest.RunServer(&opts)
+	t.Cleanup(srv.Shutdown)
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := EnsureLogsStream(js); err != nil {
+		t.Fatal(err)
+	}
+	return js
+}
+
+// publish - публикует числа from..to в subject.
+func publish(t *testing.T, js nats.JetStreamContext, subject string, from, to int) {
+	t.Helper()
+	for i := from; i <= to; i++ {
+		data, _ := json.Marshal(i)
+		if _, err := js.Publish(subject, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// waitSent - ждет, пока sender получит count сообщений.
+func waitSent(t *testing.T, sender *fakeSender, count int, timeout time.Duration) {
+	t.Helper()
+	deadline := time.After(timeout)
+	for {
+		got := 0
+		for _, batch := range sender.Batches() {
+			got += len(batch)
+		}
+		if got >= count {
+			return
+		}
+		select {
+		case <-sender.sent:
+		case <-deadline:
+			t.Fatalf("expected %d messages, got %v", count, sender.Batches())
+		}
+	}
+}
+
+// pending - сколько сообщений consumer ждут подтверждения или доставки.
+func pending(t *testing.T, js nats.JetStreamContext, durable string) (ackPending int, numPending uint64) {
+	t.Helper()
+	info, err := js.ConsumerInfo(LogsStream, durable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.NumAckPending, info.NumPending
+}
+
+func TestJetStreamWorkerRedelivery(t *testing.T) {
+	js := jetStreamTest(t)
+	subject, durable := "logs.test", "test"
+	publish(t, js, subject, 1, 3)
+
+	// Первая попытка отправки падает, сообщения должны прийти заново.
+	sender := newFakeSender()
+	sender.err = errors.New("clickhouse is down")
+	w := NewJetStreamWorker[int](js, durable, sender, 10, 100*time.Millisecond)
+	if err := w.Start(subject); err != nil {
+		t.Fatal(err)
+	}
+	sender.wait(t, 5*time.Second)
+	if err := w.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if ackPending, _ := pending(t, js, durable); ackPending != 3 {
+		t.Fatalf("expected failed batch to stay unacked, got %d pending acks", ackPending)
+	}
+
+	sender = newFakeSender()
+	w = NewJetStreamWorker[int](js, durable, sender, 10, 100*time.Millisecond)
+	if err := w.Start(subject); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop(context.Background())
+	waitSent(t, sender, 3, 3*jetStreamNakDelay)
+}
+
+func TestJetStreamWorkerAck(t *testing.T) {
+	js := jetStreamTest(t)
+	subject, durable := "logs.test", "test"
+	publish(t, js, subject, 1, 3)
+
+	sender := newFakeSender()
+	w := NewJetStreamWorker[int](js, durable, sender, 10, 100*time.Millisecond)
+	if err := w.Start(subject); err != nil {
+		t.Fatal(err)
+	}
+	waitSent(t, sender, 3, 5*time.Second)
+	if err := w.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Ack уходит без подтверждения сервера, ждем, пока он его обработает.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ackPending, numPending := pending(t, js, durable)
+		if ackPending == 0 && numPending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected sent batch to be acked, got %d pending acks and %d pending messages", ackPending, numPending)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if batches := sender.Batches(); len(batches) != 1 {
+		t.Fatalf("expected one batch without redelivery, got %v", batches)
+	}
+}
+
+func TestJetStreamWorkerInProgress(t *testing.T) {
+	js := jetStreamTest(t)
+	subject, durable := "logs.test", "test"
+	if _, err := js.AddConsumer(LogsStream, &nats.ConsumerConfig{
+		Durable:       durable,
+		FilterSubject: subject,
+		AckPolicy:     nats.AckExplicitPolicy,
+		AckWait:       300 * time.Millisecond,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	publish(t, js, subject, 1, 1)
+
+	// Отправка дольше AckWait, но пачка не должна прийти заново, пока отправляется.
+	sender := newFakeSender()
+	sender.block = make(chan struct{})
+	w := NewJetStreamWorker[int](js, durable, sender, 10, 100*time.Millisecond)
+	if err := w.Start(subject); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop(context.Background())
+	defer close(sender.block)
+	sender.wait(t, 5*time.Second)
+
+	// Второй читатель того же consumer получил бы сообщение, если бы истек AckWait.
+	sub, err := js.PullSubscribe(subject, durable, nats.BindStream(LogsStream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgs, err := sub.Fetch(1, nats.MaxWait(time.Second)); !errors.Is(err, nats.ErrTimeout) {
+		t.Fatalf("expected no redelivery while sending, got %d messages, %v", len(msgs), err)
+	}
+}
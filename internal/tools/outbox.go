@@ -0,0 +1,204 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+	"github.com/yudgxe/hezzl-test/internal/database/sqlc"
+	"github.com/yudgxe/hezzl-test/internal/tracing"
+	"github.com/yudgxe/hezzl-test/internal/types"
+)
+
+const (
+	// outboxMaxBackoff - максимальная пауза между попытками, когда nats или база недоступны.
+	outboxMaxBackoff = time.Minute
+	// outboxRetention - сколько хранятся отправленные события.
+	outboxRetention = 24 * time.Hour
+	// outboxFlushTimeout - сколько ждать подтверждения от nats, что сообщения дошли до сервера.
+	outboxFlushTimeout = 5 * time.Second
+)
+
+type OutboxDB interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// OutboxRelay - переносит события из таблицы outbox_events в nats.
+// Событие отмечается отправленным только после того, как nats подтвердил получение,
+// при ошибках отправка повторяется с растущей паузой.
+type OutboxRelay struct {
+	db   OutboxDB
+	nats *nats.Conn
+	// js - если задан, события публикуются в JetStream с подтверждением от стрима.
+	js        nats.JetStreamContext
+	batchSize int
+	interval  time.Duration
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewOutboxRelay(db OutboxDB, nats *nats.Conn, js nats.JetStreamContext, batchSize int, interval time.Duration) *OutboxRelay {
+	return &OutboxRelay{
+		db:        db,
+		nats:      nats,
+		js:        js,
+		batchSize: batchSize,
+		interval:  interval,
+		done:      make(chan struct{}),
+	}
+}
+
+// Start - запускает relay в отдельной горутине.
+func (r *OutboxRelay) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	go r.run(ctx)
+}
+
+// Stop - останавливает relay и ждет окончания текущей отправки.
+// Неотправленные события останутся в outbox до следующего запуска.
+func (r *OutboxRelay) Stop(ctx context.Context) error {
+	if r.cancel == nil {
+		return nil
+	}
+	r.cancel()
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *OutboxRelay) run(ctx context.Context) {
+	defer close(r.done)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	backoff := r.interval
+	var cleanedAt time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		n, err := r.Relay(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		switch {
+		case err != nil:
+			log.Error().Err(err).Dur("backoff", backoff).Msg("failed to relay outbox")
+			timer.Reset(backoff)
+			backoff = min(backoff*2, outboxMaxBackoff)
+			continue
+		case n == r.batchSize:
+			// Очередь не разобрана, продолжаем без паузы.
+			timer.Reset(0)
+		default:
+			timer.Reset(r.interval)
+		}
+		backoff = r.interval
+
+		if time.Since(cleanedAt) > time.Hour {
+			if err := r.cleanup(ctx); err != nil {
+				log.Error().Err(err).Msg("failed to clean outbox")
+			}
+			cleanedAt = time.Now()
+		}
+	}
+}
+
+// Relay - отправляет одну пачку неотправленных событий, возвращает сколько отправлено.
+func (r *OutboxRelay) Relay(ctx context.Context) (int, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(context.Background())
+
+	q := sqlc.New(tx)
+	events, err := q.ListPendingOutboxEvents(ctx, r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := make([]int64, 0, len(events))
+	var publishErr error
+	for _, event := range events {
+		msg := nats.NewMsg(event.Subject)
+		msg.Data = event.Payload.Bytes
+		// По id события JetStream отбрасывает повторы, если relay отправит событие дважды.
+		msg.Header.Set(nats.MsgIdHdr, fmt.Sprintf("outbox-%d", event.ID))
+		if publishErr = r.publish(ctx, event, msg); publishErr != nil {
+			// Порядок событий важен, поэтому остальные ждут следующей попытки.
+			if err := q.MarkOutboxEventFailed(ctx, sqlc.MarkOutboxEventFailedParams{
+				LastError: types.NullString{NullString: sql.NullString{String: publishErr.Error(), Valid: true}},
+				ID:        event.ID,
+			}); err != nil {
+				return 0, err
+			}
+			break
+		}
+		sent = append(sent, event.ID)
+	}
+	if len(sent) > 0 {
+		if r.js == nil {
+			if err := r.nats.FlushTimeout(outboxFlushTimeout); err != nil {
+				return 0, err
+			}
+		}
+		if err := q.MarkOutboxEventsSent(ctx, sent); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return len(sent), publishErr
+}
+
+// publish - отправляет событие в трейсе запроса, который его создал.
+func (r *OutboxRelay) publish(ctx context.Context, event sqlc.OutboxEvent, msg *nats.Msg) (err error) {
+	var headers map[string]string
+	if event.Headers.Status == pgtype.Present {
+		if err := json.Unmarshal(event.Headers.Bytes, &headers); err != nil {
+			log.Error().Err(err).Int64("id", event.ID).Msg("failed to decode outbox headers")
+		}
+	}
+	ctx, span := tracing.PublishSpan(tracing.FromHeaders(ctx, headers), msg.Subject)
+	defer func() { tracing.End(span, err) }()
+	tracing.InjectNATS(ctx, msg)
+
+	if r.js != nil {
+		_, err := r.js.PublishMsg(msg)
+		return err
+	}
+	return r.nats.PublishMsg(msg)
+}
+
+func (r *OutboxRelay) cleanup(ctx context.Context) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	deleted, err := sqlc.New(tx).DeleteSentOutboxEvents(ctx, sql.NullTime{Time: time.Now().Add(-outboxRetention), Valid: true})
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		log.Info().Int64("count", deleted).Msg("cleaned outbox")
+	}
+	return tx.Commit(ctx)
+}
@@ -1,23 +1,36 @@
 package tools
 
-import "github.com/gin-gonic/gin"
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
 
 const (
 	paginationDefaultLimit  = 10
 	paginationDefaultOffset = 1
+	// PaginationMaxLimit - максимальный размер страницы, больше за один запрос не отдаем.
+	PaginationMaxLimit = 100
 )
 
+var ErrLimitTooLarge = errors.New("limit must not exceed " + strconv.Itoa(PaginationMaxLimit))
+
 type Pagination struct {
 	Limit  int `json:"limit" form:"limit"  example:"10"`
 	Offset int `json:"offset" form:"offset" example:"1"`
 }
 
-// GetPage - биндит Pagination, при ошибке возвращает значания по умолчанию.
-func GetPagination(g *gin.Context) Pagination {
+// GetPagination - биндит Pagination, при ошибке возвращает значания по умолчанию.
+// Limit больше PaginationMaxLimit - ошибка ErrLimitTooLarge.
+func GetPagination(g *gin.Context) (Pagination, error) {
 	p := Pagination{}
-	if g.BindQuery(&p) != nil {
+	if g.ShouldBindQuery(&p) != nil {
 		p.Limit = paginationDefaultLimit
 		p.Offset = paginationDefaultOffset
 	}
-	return p
+	if p.Limit > PaginationMaxLimit {
+		return p, ErrLimitTooLarge
+	}
+	return p, nil
 }
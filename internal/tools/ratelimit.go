@@ -0,0 +1,104 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimit - не больше Requests запросов за скользящее окно Window.
+// Нулевой лимит означает отсутствие ограничений.
+type RateLimit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// ParseRateLimit - разбирает лимит вида 100/1m, пустая строка или 0 - без ограничений.
+func ParseRateLimit(s string) (RateLimit, error) {
+	if s == "" || s == "0" {
+		return RateLimit{}, nil
+	}
+	requests, window, ok := strings.Cut(s, "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q, expected requests/window, e.g. 100/1m", s)
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil || n < 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit requests %q", requests)
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit window %q", window)
+	}
+	return RateLimit{Requests: n, Window: d}, nil
+}
+
+func (l RateLimit) Enabled() bool { return l.Requests > 0 && l.Window > 0 }
+
+func (l RateLimit) String() string {
+	if !l.Enabled() {
+		return "0"
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, l.Window)
+}
+
+// RateLimitResult - результат проверки лимита.
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset - через сколько освободится место в окне.
+	Reset time.Duration
+}
+
+// rateLimitScript - скользящее окно на sorted set: в нем лежат времена запросов за последнее окно.
+// Возвращает {разрешен ли запрос, сколько осталось, через сколько мс освободится место}.
+var rateLimitScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+local count = redis.call('ZCARD', key)
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', key, now, ARGV[4])
+	redis.call('PEXPIRE', key, window)
+	count = count + 1
+	allowed = 1
+end
+
+local reset = 0
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window - now
+end
+return {allowed, limit - count, reset}
+`)
+
+func rateLimitKey(class, client string) string {
+	return fmt.Sprintf("ratelimit:%s:%s", class, client)
+}
+
+// AllowRate - учитывает запрос клиента в окне лимита класса class и говорит, можно ли его выполнять.
+func (c *Cache) AllowRate(ctx context.Context, class, client string, limit RateLimit) (RateLimitResult, error) {
+	now := time.Now().UnixMilli()
+	member := fmt.Sprintf("%d-%d", now, rand.Int63())
+	values, err := rateLimitScript.Run(ctx, c.Client, []string{rateLimitKey(class, client)},
+		now, limit.Window.Milliseconds(), limit.Requests, member).Int64Slice()
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	return RateLimitResult{
+		Allowed:   values[0] == 1,
+		Limit:     limit.Requests,
+		Remaining: int(values[1]),
+		Reset:     time.Duration(values[2]) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,71 @@
+package tools
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	for _, tt := range []struct {
+		in       string
+		expected RateLimit
+		err      bool
+	}{
+		{in: "", expected: RateLimit{}},
+		{in: "0", expected: RateLimit{}},
+		{in: "100/1m", expected: RateLimit{Requests: 100, Window: time.Minute}},
+		{in: "5/500ms", expected: RateLimit{Requests: 5, Window: 500 * time.Millisecond}},
+		{in: "0/1s", expected: RateLimit{Window: time.Second}},
+		{in: "100", err: true},
+		{in: "x/1m", err: true},
+		{in: "-1/1m", err: true},
+		{in: "100/x", err: true},
+		{in: "100/0s", err: true},
+		{in: "100/-1m", err: true},
+	} {
+		got, err := ParseRateLimit(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("%q: unexpected error %v", tt.in, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("%q: expected %+v, got %+v", tt.in, tt.expected, got)
+		}
+	}
+}
+
+func TestAllowRate(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cache := NewCache(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	ctx := context.Background()
+	limit := RateLimit{Requests: 2, Window: time.Minute}
+
+	for i, expected := range []RateLimitResult{
+		{Allowed: true, Limit: 2, Remaining: 1},
+		{Allowed: true, Limit: 2, Remaining: 0},
+		{Allowed: false, Limit: 2, Remaining: 0},
+	} {
+		got, err := cache.AllowRate(ctx, "read", "client", limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Allowed != expected.Allowed || got.Limit != expected.Limit || got.Remaining != expected.Remaining {
+			t.Errorf("request %d: expected %+v, got %+v", i+1, expected, got)
+		}
+		if got.Reset <= 0 || got.Reset > limit.Window {
+			t.Errorf("request %d: expected reset within window, got %s", i+1, got.Reset)
+		}
+	}
+
+	// Лимиты разных клиентов и классов не пересекаются.
+	if got, err := cache.AllowRate(ctx, "write", "client", limit); err != nil || !got.Allowed {
+		t.Errorf("expected other class to be allowed, got %+v, %v", got, err)
+	}
+	if got, err := cache.AllowRate(ctx, "read", "other", limit); err != nil || !got.Allowed {
+		t.Errorf("expected other client to be allowed, got %+v, %v", got, err)
+	}
+}
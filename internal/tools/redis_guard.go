@@ -0,0 +1,150 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrRedisDown - redis помечен недоступным, команда не отправлялась.
+var ErrRedisDown = errors.New("redis is down")
+
+var _ redis.Hook = (*RedisGuard)(nil)
+
+// RedisGuard - хук redis клиента для работы без кеша. Пока redis недоступен, команды сразу
+// возвращают ErrRedisDown, а не ждут таймаута соединения, поэтому чтение идет напрямую из базы.
+// Доступность проверяется через PING раз в interval.
+type RedisGuard struct {
+	client   *redis.Client
+	interval time.Duration
+	timeout  time.Duration
+	down     atomic.Bool
+	// invalidate - удаляет из кеша данные, которые могли устареть, пока redis был недоступен.
+	invalidate func(ctx context.Context) error
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// guardBypass - ключ контекста команд, которые выполняются, пока redis еще помечен недоступным.
+type guardBypass struct{}
+
+// NewRedisGuard - создает хук и добавляет его в client. Пока redis был недоступен, база менялась
+// без обновления кеша, поэтому перед тем, как снова пометить redis доступным, вызывается invalidate.
+// Если invalidate вернет ошибку, redis остается недоступным до следующей проверки.
+func NewRedisGuard(client *redis.Client, interval, timeout time.Duration, invalidate func(ctx context.Context) error) *RedisGuard {
+	guard := &RedisGuard{
+		client:     client,
+		interval:   interval,
+		timeout:    timeout,
+		invalidate: invalidate,
+		done:       make(chan struct{}),
+	}
+	client.AddHook(guard)
+	return guard
+}
+
+// Up - доступен ли redis по последней проверке.
+func (g *RedisGuard) Up() bool {
+	return !g.down.Load()
+}
+
+// Start - проверяет redis сразу и дальше в отдельной горутине.
+func (g *RedisGuard) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	g.cancel = cancel
+	g.probe(ctx)
+	go g.run(ctx)
+}
+
+// Stop - останавливает проверки.
+func (g *RedisGuard) Stop() {
+	g.cancel()
+	<-g.done
+}
+
+func (g *RedisGuard) run(ctx context.Context) {
+	defer close(g.done)
+
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			g.probe(ctx)
+		}
+	}
+}
+
+func (g *RedisGuard) probe(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+
+	err := g.client.Ping(ctx).Err()
+	if ctx.Err() != nil && errors.Is(err, context.Canceled) {
+		return
+	}
+	if err == nil && g.down.Load() && g.invalidate != nil {
+		if err = g.invalidate(context.WithValue(ctx, guardBypass{}, true)); err != nil {
+			log.Error().Err(err).Msg("failed to invalidate cache, redis stays down")
+			return
+		}
+	}
+	g.set(err)
+}
+
+// blocked - команду нельзя отправлять, пока redis помечен недоступным.
+func (g *RedisGuard) blocked(ctx context.Context) bool {
+	return g.down.Load() && ctx.Value(guardBypass{}) == nil
+}
+
+// set - обновляет состояние по результату команды, пишет в лог только смену состояния.
+func (g *RedisGuard) set(err error) {
+	down := err != nil
+	if g.down.Swap(down) != down {
+		if down {
+			log.Warn().Err(err).Msg("redis is down, serving without cache")
+		} else {
+			log.Info().Msg("redis is up")
+		}
+	}
+}
+
+func (g *RedisGuard) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (g *RedisGuard) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		// PING пропускаем всегда, иначе redis не удастся снова пометить доступным.
+		if g.blocked(ctx) && cmd.Name() != "ping" {
+			return ErrRedisDown
+		}
+		err := next(ctx, cmd)
+		// Не дожидаемся следующего PING, если соединение с redis уже не удалось.
+		var netErr net.Error
+		if errors.As(err, &netErr) {
+			g.set(err)
+		}
+		return err
+	}
+}
+
+func (g *RedisGuard) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if g.blocked(ctx) {
+			for _, cmd := range cmds {
+				cmd.SetErr(ErrRedisDown)
+			}
+			return ErrRedisDown
+		}
+		return next(ctx, cmds)
+	}
+}
@@ -0,0 +1,84 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newGuardTest(t *testing.T) (*miniredis.Miniredis, *Cache, *RedisGuard) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	cache := NewCache(client)
+	return mr, cache, NewRedisGuard(client, time.Hour, time.Second, cache.DelCached)
+}
+
+func TestRedisGuardDown(t *testing.T) {
+	mr, cache, guard := newGuardTest(t)
+	ctx := context.Background()
+	guard.set(errors.New("connection refused"))
+
+	// Пока redis помечен недоступным, команды не доходят до сервера.
+	before := mr.CommandCount()
+	if err := cache.Get(ctx, "key").Err(); !errors.Is(err, ErrRedisDown) {
+		t.Fatalf("expected ErrRedisDown, got %v", err)
+	}
+	pipe := cache.Pipeline()
+	pipe.Get(ctx, "key")
+	if _, err := pipe.Exec(ctx); !errors.Is(err, ErrRedisDown) {
+		t.Fatalf("expected ErrRedisDown from pipeline, got %v", err)
+	}
+	if after := mr.CommandCount(); after != before {
+		t.Fatalf("expected no commands to reach redis, got %d", after-before)
+	}
+}
+
+func TestRedisGuardNetError(t *testing.T) {
+	mr, cache, guard := newGuardTest(t)
+	if !guard.Up() {
+		t.Fatal("expected guard to start up")
+	}
+	mr.Close()
+	if err := cache.Get(context.Background(), "key").Err(); err == nil {
+		t.Fatal("expected error from closed redis")
+	}
+	if guard.Up() {
+		t.Fatal("expected network error to mark redis down")
+	}
+}
+
+func TestRedisGuardRecover(t *testing.T) {
+	mr, cache, guard := newGuardTest(t)
+	ctx := context.Background()
+	for _, key := range []string{"good_1_1", "1:1:0:1", "cursor:0:10:", "project:1", "idempotency_write_key", "ratelimit:read:ip:1"} {
+		mr.Set(key, "{}")
+	}
+	guard.set(errors.New("connection refused"))
+
+	guard.probe(ctx)
+	if !guard.Up() {
+		t.Fatal("expected successful ping to mark redis up")
+	}
+	// Пока redis был недоступен, база менялась, поэтому закешированные данные удаляются.
+	for key, expected := range map[string]bool{
+		"good_1_1":              false,
+		"1:1:0:1":               false,
+		"cursor:0:10:":          false,
+		"project:1":             false,
+		"idempotency_write_key": true,
+		"ratelimit:read:ip:1":   true,
+	} {
+		if mr.Exists(key) != expected {
+			t.Errorf("%s: expected exists = %v", key, expected)
+		}
+	}
+	if err := cache.Get(ctx, "idempotency_write_key").Err(); err != nil {
+		t.Fatalf("expected commands to pass after recovery, got %v", err)
+	}
+}
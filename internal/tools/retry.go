@@ -0,0 +1,89 @@
+package tools
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// RetryPolicy - повторы с экспоненциальной паузой и случайным разбросом.
+type RetryPolicy struct {
+	// Attempts - сколько всего попыток, вместе с первой.
+	Attempts int
+	// InitialBackoff - пауза после первой неудачной попытки, дальше она удваивается.
+	InitialBackoff time.Duration
+	// MaxBackoff - максимальная пауза.
+	MaxBackoff time.Duration
+	// Jitter - доля паузы от 0 до 1, на которую она случайно уменьшается,
+	// чтобы воркеры не повторяли запросы одновременно.
+	Jitter float64
+}
+
+// Backoff - пауза перед попыткой attempt, попытки считаются с 1.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * p.Jitter * float64(d))
+	}
+	return d
+}
+
+// Do - выполняет fn, пока она не пройдет, не кончатся попытки или ctx.
+func (p RetryPolicy) Do(ctx context.Context, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if attempt >= p.Attempts {
+			return err
+		}
+		backoff := p.Backoff(attempt)
+		log.Warn().Err(err).Int("attempt", attempt).Dur("backoff", backoff).Msg("retrying")
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// RetrySender - Sender, который повторяет неудачные отправки, а пачки,
+// которые так и не удалось отправить, кладет в DeadLetter.
+type RetrySender[T any] struct {
+	sender     Sender[T]
+	policy     RetryPolicy
+	deadLetter DeadLetter
+}
+
+func NewRetrySender[T any](sender Sender[T], policy RetryPolicy, deadLetter DeadLetter) *RetrySender[T] {
+	return &RetrySender[T]{
+		sender:     sender,
+		policy:     policy,
+		deadLetter: deadLetter,
+	}
+}
+
+// Send - ошибка возвращается, только если пачку не удалось ни отправить, ни сохранить в DeadLetter.
+func (s *RetrySender[T]) Send(ctx context.Context, batch []T) error {
+	err := s.policy.Do(ctx, func() error { return s.sender.Send(ctx, batch) })
+	if err == nil || s.deadLetter == nil {
+		return err
+	}
+	if dlErr := s.deadLetter.Put(batch, err); dlErr != nil {
+		log.Error().Err(dlErr).Msg("failed to put batch to dead letter")
+		return err
+	}
+	log.Error().Err(err).Msg("batch moved to dead letter")
+	return nil
+}
@@ -0,0 +1,97 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for attempt, expected := range map[int]time.Duration{
+		1:  100 * time.Millisecond,
+		2:  200 * time.Millisecond,
+		4:  800 * time.Millisecond,
+		5:  time.Second,
+		50: time.Second,
+	} {
+		if got := p.Backoff(attempt); got != expected {
+			t.Errorf("attempt %d: expected %s, got %s", attempt, expected, got)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.Backoff(2); got < 100*time.Millisecond || got > 200*time.Millisecond {
+			t.Fatalf("backoff with jitter out of range: %s", got)
+		}
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	p := RetryPolicy{Attempts: 3, InitialBackoff: time.Millisecond}
+
+	calls := 0
+	err := p.Do(context.Background(), func() error {
+		calls++
+		if calls < 2 {
+			return errors.New("fail")
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Fatalf("expected success on second call, got %v after %d calls", err, calls)
+	}
+
+	calls = 0
+	err = p.Do(context.Background(), func() error {
+		calls++
+		return errors.New("fail")
+	})
+	if err == nil || calls != 3 {
+		t.Fatalf("expected error after 3 calls, got %v after %d calls", err, calls)
+	}
+}
+
+func TestRetrySenderDeadLetter(t *testing.T) {
+	deadLetter, err := NewFileDeadLetter(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := newFakeSender()
+	sender.err = errors.New("clickhouse is down")
+	s := NewRetrySender(sender, RetryPolicy{Attempts: 2, InitialBackoff: time.Millisecond}, deadLetter)
+
+	if err := s.Send(context.Background(), []int{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if batches := sender.Batches(); len(batches) != 2 {
+		t.Fatalf("expected 2 attempts, got %d", len(batches))
+	}
+
+	files, err := deadLetter.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("expected 1 dead letter file, got %d", len(files))
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record DeadLetterRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatal(err)
+	}
+	var items []int
+	if err := json.Unmarshal(record.Items, &items); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 || record.Error != "clickhouse is down" {
+		t.Fatalf("unexpected record %+v", record)
+	}
+}
@@ -1,57 +1,147 @@
 package tools
 
 import (
+	"context"
+	sqldriver "database/sql/driver"
+	"errors"
 	"fmt"
+	"reflect"
 	"strings"
 
-	"github.com/yudgxe/hezzl-test/internal/model/clickhouse"
-	"golang.org/x/net/context"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/yudgxe/hezzl-test/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// Sender - отправляет пачку событий.
+type Sender[T any] interface {
+	Send(ctx context.Context, batch []T) error
+}
+
+// Store - соединение с clickhouse.
 type Store interface {
-	Exec(ctx context.Context, query string, args ...any) error
+	PrepareBatch(ctx context.Context, query string, opts ...driver.PrepareBatchOption) (driver.Batch, error)
 }
 
-type GoodSender struct {
-	store Store
+var _ Sender[struct{}] = (*ClickHouseSender[struct{}])(nil)
+
+// ClickHouseSender - пишет пачки структур T в таблицу clickhouse.
+// Колонки берутся из тегов ch полей T, в том числе встроенных структур, поля без тега и с ch:"-" пропускаются.
+type ClickHouseSender[T any] struct {
+	store  Store
+	table  string
+	query  string
+	fields [][]int
 }
 
-func NewGoodSender(store Store) *GoodSender {
-	return &GoodSender{
-		store: store,
+func NewClickHouseSender[T any](store Store, table string) (*ClickHouseSender[T], error) {
+	columns, fields, err := chColumns(reflect.TypeOf((*T)(nil)).Elem(), nil)
+	if err != nil {
+		return nil, err
 	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("%T has no ch tagged fields", *new(T))
+	}
+	return &ClickHouseSender[T]{
+		store:  store,
+		table:  table,
+		query:  fmt.Sprintf("INSERT INTO %s (%s)", table, strings.Join(columns, ", ")),
+		fields: fields,
+	}, nil
 }
 
-func (s *GoodSender) Send(data interface{}) error {
-	switch v := data.(type) {
-	case []clickhouse.Good:
-		if len(v) <= 0 {
-			return nil
+// chColumns - колонки и пути к полям структуры t в порядке объявления.
+func chColumns(t reflect.Type, index []int) ([]string, [][]int, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, nil, errors.New("clickhouse sender supports only structs")
+	}
+	var columns []string
+	var fields [][]int
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		path := append(append([]int(nil), index...), i)
+		tag, tagged := field.Tag.Lookup("ch")
+		if tag == "-" || !field.IsExported() && !field.Anonymous {
+			continue
 		}
+		if !tagged {
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				c, f, err := chColumns(field.Type, path)
+				if err != nil {
+					return nil, nil, err
+				}
+				columns, fields = append(columns, c...), append(fields, f...)
+			}
+			continue
+		}
+		columns = append(columns, tag)
+		fields = append(fields, path)
+	}
+	return columns, fields, nil
+}
 
-		var sb strings.Builder
+var (
+	valuerType = reflect.TypeOf((*sqldriver.Valuer)(nil)).Elem()
 
-		// TODO: reflect
-		// количество полей у структуры.
-		countField := 8
+	chBasicTypes = map[reflect.Kind]reflect.Type{
+		reflect.String:  reflect.TypeOf(""),
+		reflect.Bool:    reflect.TypeOf(false),
+		reflect.Int8:    reflect.TypeOf(int8(0)),
+		reflect.Int16:   reflect.TypeOf(int16(0)),
+		reflect.Int32:   reflect.TypeOf(int32(0)),
+		reflect.Int64:   reflect.TypeOf(int64(0)),
+		reflect.Uint8:   reflect.TypeOf(uint8(0)),
+		reflect.Uint16:  reflect.TypeOf(uint16(0)),
+		reflect.Uint32:  reflect.TypeOf(uint32(0)),
+		reflect.Uint64:  reflect.TypeOf(uint64(0)),
+		reflect.Float32: reflect.TypeOf(float32(0)),
+		reflect.Float64: reflect.TypeOf(float64(0)),
+	}
+)
 
-		args := make([]any, 0, len(v)*countField)
+// chValue - значение поля для Append. Именованные типы над строками и числами, например
+// clickhouse.EventType, драйвер не понимает, поэтому они приводятся к базовому типу.
+func chValue(v reflect.Value) any {
+	t := v.Type()
+	if t.PkgPath() == "" || t.Implements(valuerType) {
+		return v.Interface()
+	}
+	if basic, ok := chBasicTypes[v.Kind()]; ok {
+		return v.Convert(basic).Interface()
+	}
+	return v.Interface()
+}
 
-		sb.WriteString("INSERT INTO goods VALUES ")
-		for _, good := range v {
-			size := len(args) + 1
-			subquery := fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d), ", size, size+1, size+2, size+3, size+4, size+5, size+6, size+7)
-			args = append(args, good.ID, good.ProjectID, good.Name, good.Description, good.Priority, good.Removed, good.CreatedAt, good.EventTime)
+func (s *ClickHouseSender[T]) Send(ctx context.Context, batch []T) (err error) {
+	if len(batch) == 0 {
+		return nil
+	}
+	ctx, span := tracing.Tracer().Start(ctx, "clickhouse insert "+s.table,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemClickhouse,
+			semconv.DBSQLTable(s.table),
+			attribute.Int("db.clickhouse.rows", len(batch)),
+		),
+	)
+	defer func() { tracing.End(span, err) }()
 
-			sb.WriteString(subquery)
+	b, err := s.store.PrepareBatch(ctx, s.query)
+	if err != nil {
+		return err
+	}
+	values := make([]any, len(s.fields))
+	for i := range batch {
+		v := reflect.ValueOf(&batch[i]).Elem()
+		for j, path := range s.fields {
+			values[j] = chValue(v.FieldByIndex(path))
 		}
-		query := sb.String()
-		query = query[:len(query)-2]
-
-		if err := s.store.Exec(context.Background(), query, args...); err != nil {
+		if err := b.Append(values...); err != nil {
+			b.Abort()
 			return err
 		}
 	}
-
-	return nil
+	return b.Send()
 }
@@ -0,0 +1,82 @@
+package tools
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+type fakeBatch struct {
+	driver.Batch
+	rows [][]any
+	sent bool
+}
+
+func (b *fakeBatch) Append(v ...any) error {
+	b.rows = append(b.rows, append([]any(nil), v...))
+	return nil
+}
+
+func (b *fakeBatch) Send() error {
+	b.sent = true
+	return nil
+}
+
+type fakeStore struct {
+	query string
+	batch *fakeBatch
+}
+
+func (s *fakeStore) PrepareBatch(ctx context.Context, query string, opts ...driver.PrepareBatchOption) (driver.Batch, error) {
+	s.query = query
+	s.batch = &fakeBatch{}
+	return s.batch, nil
+}
+
+type testKind string
+
+type testBase struct {
+	ID int32 `ch:"id"`
+}
+
+type testEvent struct {
+	testBase
+	Name     string   `ch:"name"`
+	Kind     testKind `ch:"kind"`
+	Skipped  int      `ch:"-"`
+	Untagged int
+}
+
+func TestClickHouseSender(t *testing.T) {
+	store := &fakeStore{}
+	sender, err := NewClickHouseSender[testEvent](store, "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sender.Send(context.Background(), []testEvent{
+		{testBase: testBase{ID: 1}, Name: "a", Kind: "created", Skipped: 1},
+		{testBase: testBase{ID: 2}, Name: "b", Kind: "removed"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "INSERT INTO events (id, name, kind)"; store.query != expected {
+		t.Fatalf("expected query %q, got %q", expected, store.query)
+	}
+	expected := [][]any{{int32(1), "a", "created"}, {int32(2), "b", "removed"}}
+	if !reflect.DeepEqual(store.batch.rows, expected) {
+		t.Fatalf("expected rows %v, got %v", expected, store.batch.rows)
+	}
+	if !store.batch.sent {
+		t.Fatal("batch was not sent")
+	}
+}
+
+func TestClickHouseSenderNoColumns(t *testing.T) {
+	if _, err := NewClickHouseSender[struct{ A int }](&fakeStore{}, "events"); err == nil {
+		t.Fatal("expected error for struct without ch tags")
+	}
+}
@@ -1,55 +1,251 @@
 package tools
 
 import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/rs/zerolog/log"
+	"github.com/yudgxe/hezzl-test/internal/metrics"
+	"github.com/yudgxe/hezzl-test/internal/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/nats-io/nats.go"
 )
 
-type Sender interface {
-	Send(data interface{}) error
+// LogWorker - воркер, переносящий логи из nats в clickhouse.
+type LogWorker interface {
+	Start(subject string) error
+	Stop(ctx context.Context) error
 }
 
+var (
+	_ LogWorker = (*Worker[any])(nil)
+	_ LogWorker = (*JetStreamWorker[any])(nil)
+)
+
+// workerQueue - сколько пачек может ждать отправки, пока текущая отправляется или повторяется.
+const workerQueue = 16
+
+// Worker - копит сообщения из nats и отправляет их пачками в Sender.
+// Пачка отправляется, когда набралось batchSize сообщений или прошло flushInterval.
+// Отправкой занимается отдельная горутина, так повторы отправки не задерживают чтение из nats.
 type Worker[T any] struct {
-	sender    Sender
-	nats      *nats.EncodedConn
-	buff      []T
-	batchSize int
+	sender        Sender[T]
+	nats          *nats.EncodedConn
+	batchSize     int
+	flushInterval time.Duration
+	// subject - тема nats, метка метрик воркера.
+	subject string
+
+	// mu - защищает buff и batches, пачки ставятся в очередь в порядке поступления.
+	mu   sync.Mutex
+	buff []T
+	// links - спаны, отправившие сообщения из buff.
+	links []trace.Link
+	// batches - очередь пачек на отправку, закрывается при остановке.
+	batches chan workerBatch[T]
+	closed  bool
+
+	// ctx - контекст отправки, отменяется, если Stop не дождался отправки очереди.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	sub  *nats.Subscription
+	stop chan struct{}
+	done chan struct{}
+	// sent - закрывается, когда отправлена вся очередь.
+	sent chan struct{}
 
-	onclose func()
+	// started - запущены ли горутины воркера, без них Stop нечего ждать.
+	started  atomic.Bool
+	stopOnce sync.Once
+	stopErr  error
 }
 
-func NewWorker[T any](nats *nats.EncodedConn, sender Sender, batchSize int) *Worker[T] {
+type workerBatch[T any] struct {
+	items []T
+	links []trace.Link
+}
+
+func NewWorker[T any](nats *nats.EncodedConn, sender Sender[T], batchSize int, flushInterval time.Duration) *Worker[T] {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Worker[T]{
-		nats:      nats,
-		batchSize: batchSize,
-		buff:      make([]T, 0, batchSize),
-		sender:    sender,
+		nats:          nats,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		buff:          make([]T, 0, batchSize),
+		batches:       make(chan workerBatch[T], workerQueue),
+		sender:        sender,
+		ctx:           ctx,
+		cancel:        cancel,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+		sent:          make(chan struct{}),
 	}
 }
 
 func (w *Worker[T]) Start(subject string) error {
-	sub, err := w.nats.Subscribe(subject, func(in T) {
-		w.buff = append(w.buff, in)
-		if len(w.buff) == w.batchSize {
-			if err := w.sender.Send(w.buff); err != nil {
-				log.Error().Err(err).Msg("failed to send")
-			}
-			w.buff = make([]T, 0, w.batchSize)
-		}
-	})
+	w.subject = subject
+	sub, err := w.nats.Subscribe(subject, w.receive)
 	if err != nil {
 		return err
 	}
-	w.onclose = func() {
-		if err := sub.Unsubscribe(); err != nil {
-			log.Error().Err(err).Msg("failed to unsubscribe")
+	w.sub = sub
+	w.run()
+	return nil
+}
+
+// run - запускает отправку очереди и отправку по времени.
+func (w *Worker[T]) run() {
+	w.started.Store(true)
+	go func() {
+		defer close(w.sent)
+		for batch := range w.batches {
+			if err := sendBatch(w.ctx, w.sender, w.subject, batch.items, batch.links); err != nil {
+				log.Error().Err(err).Int("count", len(batch.items)).Msg("failed to send")
+			}
 		}
+	}()
+	go func() {
+		defer close(w.done)
+		ticker := time.NewTicker(w.flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+				w.flush()
+			}
+		}
+	}()
+}
+
+// receive - декодирует сообщение и добавляет его в буфер вместе с контекстом трейса отправителя.
+func (w *Worker[T]) receive(msg *nats.Msg) {
+	var in T
+	if err := w.nats.Enc.Decode(msg.Subject, msg.Data, &in); err != nil {
+		log.Error().Err(err).Str("subject", msg.Subject).Msg("failed to decode, dropping")
+		return
+	}
+	w.add(in, tracing.LinkNATS(msg))
+}
+
+func (w *Worker[T]) add(in T, link trace.Link) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		log.Error().Str("subject", w.subject).Msg("worker is stopped, dropping")
+		return
+	}
+	w.buff = append(w.buff, in)
+	w.links = append(w.links, link)
+	metrics.WorkerBuffered.WithLabelValues(w.subject).Set(float64(len(w.buff)))
+	if len(w.buff) >= w.batchSize {
+		w.sendLocked()
 	}
-	return nil
 }
 
-func (w *Worker[T]) Stop() {
-	w.onclose()
-	w.sender.Send(w.buff)
+func (w *Worker[T]) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.sendLocked()
+}
+
+// sendLocked - ставит буфер в очередь на отправку. Если очередь заполнена, ждет места в ней,
+// тогда сообщения копятся в буфере подписки nats.
+func (w *Worker[T]) sendLocked() {
+	if len(w.buff) == 0 || w.closed {
+		return
+	}
+	w.batches <- workerBatch[T]{items: w.buff, links: w.links}
+	w.buff = make([]T, 0, w.batchSize)
+	w.links = nil
+	metrics.WorkerBuffered.WithLabelValues(w.subject).Set(0)
+}
+
+// sendBatch - отправляет пачку и пишет метрики отправки. Спан пачки ссылается на спаны,
+// которые отправили ее сообщения, так пачка связывается с исходными запросами.
+func sendBatch[T any](ctx context.Context, sender Sender[T], subject string, batch []T, links []trace.Link) error {
+	valid := make([]trace.Link, 0, len(links))
+	for _, link := range links {
+		if link.SpanContext.IsValid() {
+			valid = append(valid, link)
+		}
+	}
+	ctx, span := tracing.Tracer().Start(ctx, "process "+subject,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(valid...),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("nats"),
+			semconv.MessagingDestinationName(subject),
+			semconv.MessagingBatchMessageCount(len(batch)),
+		),
+	)
+
+	start := time.Now()
+	err := sender.Send(ctx, batch)
+	tracing.End(span, err)
+	result := metrics.Result(err)
+	metrics.WorkerBatchDuration.WithLabelValues(subject).Observe(time.Since(start).Seconds())
+	metrics.WorkerBatches.WithLabelValues(subject, result).Inc()
+	metrics.WorkerMessages.WithLabelValues(subject, result).Add(float64(len(batch)))
+	return err
+}
+
+// Stop - дочитывает уже полученные из nats сообщения, останавливает отправку по времени
+// и отправляет остаток буфера и очередь. Если ctx закончится раньше, чем nats отдаст все сообщения,
+// остаток все равно отправляется, а возвращается ошибка ctx. Если ctx закончится во время отправки,
+// повторы прерываются, и неотправленные пачки уходят в DeadLetter RetrySender.
+// Повторный Stop возвращает результат первого, Stop незапущенного воркера ничего не делает.
+func (w *Worker[T]) Stop(ctx context.Context) error {
+	w.stopOnce.Do(func() {
+		if w.started.Load() {
+			w.stopErr = w.shutdown(ctx)
+		}
+	})
+	return w.stopErr
+}
+
+func (w *Worker[T]) shutdown(ctx context.Context) error {
+	defer context.AfterFunc(ctx, w.cancel)()
+
+	var err error
+	if w.sub != nil {
+		if err = w.sub.Drain(); err == nil {
+			err = waitDrained(ctx, w.sub)
+		}
+	}
+	close(w.stop)
+	<-w.done
+
+	w.mu.Lock()
+	w.sendLocked()
+	w.closed = true
+	close(w.batches)
+	w.mu.Unlock()
+
+	<-w.sent
+	w.cancel()
+	if err == nil {
+		err = ctx.Err()
+	}
+	return err
+}
+
+// waitDrained - ждет, пока подписка обработает все сообщения и закроется.
+func waitDrained(ctx context.Context, sub *nats.Subscription) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for sub.IsValid() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
 }
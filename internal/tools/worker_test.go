@@ -0,0 +1,279 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/yudgxe/hezzl-test/internal/metrics"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type fakeSender struct {
+	mu      sync.Mutex
+	batches [][]int
+	sent    chan struct{}
+	err     error
+	// block - если задан, Send ждет его закрытия или отмены ctx.
+	block chan struct{}
+}
+
+func newFakeSender() *fakeSender {
+	return &fakeSender{sent: make(chan struct{}, 100)}
+}
+
+func (s *fakeSender) Send(ctx context.Context, batch []int) error {
+	s.mu.Lock()
+	s.batches = append(s.batches, append([]int(nil), batch...))
+	err, block := s.err, s.block
+	s.mu.Unlock()
+	s.sent <- struct{}{}
+	if block != nil {
+		select {
+		case <-block:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+func (s *fakeSender) setErr(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+}
+
+func (s *fakeSender) Batches() [][]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]int(nil), s.batches...)
+}
+
+func (s *fakeSender) wait(t *testing.T, timeout time.Duration) {
+	t.Helper()
+	select {
+	case <-s.sent:
+	case <-time.After(timeout):
+		t.Fatal("batch was not sent")
+	}
+}
+
+func TestWorkerFlushOnSize(t *testing.T) {
+	sender := newFakeSender()
+	w := NewWorker[int](nil, sender, 3, time.Hour)
+	w.run()
+
+	for i := 1; i <= 7; i++ {
+		w.add(i, trace.Link{})
+	}
+	sender.wait(t, time.Second)
+	sender.wait(t, time.Second)
+	if batches := sender.Batches(); len(batches) != 2 || len(batches[0]) != 3 || len(batches[1]) != 3 {
+		t.Fatalf("expected two full batches, got %v", batches)
+	}
+	if err := w.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	batches := sender.Batches()
+	if len(batches) != 3 || len(batches[2]) != 1 || batches[2][0] != 7 {
+		t.Fatalf("expected rest to be flushed on stop, got %v", batches)
+	}
+}
+
+func TestWorkerFlushOnInterval(t *testing.T) {
+	sender := newFakeSender()
+	w := NewWorker[int](nil, sender, 10, 20*time.Millisecond)
+	w.run()
+	defer w.Stop(context.Background())
+
+	w.add(1, trace.Link{})
+	w.add(2, trace.Link{})
+	sender.wait(t, time.Second)
+	if batches := sender.Batches(); len(batches) != 1 || len(batches[0]) != 2 {
+		t.Fatalf("expected one batch of two, got %v", batches)
+	}
+}
+
+func TestWorkerStopEmpty(t *testing.T) {
+	sender := newFakeSender()
+	w := NewWorker[int](nil, sender, 10, time.Hour)
+	w.run()
+	if err := w.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if batches := sender.Batches(); len(batches) != 0 {
+		t.Fatalf("expected no batches, got %v", batches)
+	}
+}
+
+func TestWorkerConcurrentAdd(t *testing.T) {
+	sender := newFakeSender()
+	sender.sent = make(chan struct{}, 1000)
+	w := NewWorker[int](nil, sender, 7, time.Millisecond)
+	w.run()
+
+	const writers, perWriter = 8, 100
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < perWriter; j++ {
+				w.add(i*perWriter+j, trace.Link{})
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := w.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[int]bool, writers*perWriter)
+	for _, batch := range sender.Batches() {
+		if len(batch) > 7 {
+			t.Fatalf("batch larger than batch size: %d", len(batch))
+		}
+		for _, v := range batch {
+			if seen[v] {
+				t.Fatalf("duplicate %d", v)
+			}
+			seen[v] = true
+		}
+	}
+	if len(seen) != writers*perWriter {
+		t.Fatalf("expected %d values, got %d", writers*perWriter, len(seen))
+	}
+}
+
+func TestWorkerSendError(t *testing.T) {
+	sender := newFakeSender()
+	sender.err = errors.New("clickhouse is down")
+	w := NewWorker[int](nil, sender, 2, time.Hour)
+	w.run()
+
+	w.add(1, trace.Link{})
+	w.add(2, trace.Link{})
+	w.add(3, trace.Link{})
+	if err := w.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if batches := sender.Batches(); len(batches) != 2 {
+		t.Fatalf("expected failed batch to be dropped and rest flushed, got %v", batches)
+	}
+}
+
+func TestWorkerMetrics(t *testing.T) {
+	sender := newFakeSender()
+	w := NewWorker[int](nil, sender, 2, time.Hour)
+	w.subject = "test.metrics"
+	w.run()
+
+	w.add(1, trace.Link{})
+	if got := testutil.ToFloat64(metrics.WorkerBuffered.WithLabelValues(w.subject)); got != 1 {
+		t.Fatalf("expected 1 buffered message, got %v", got)
+	}
+	w.add(2, trace.Link{})
+	sender.wait(t, time.Second)
+	sender.setErr(errors.New("clickhouse is down"))
+	w.add(3, trace.Link{})
+	if err := w.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for result, expected := range map[string]float64{"ok": 1, "error": 1} {
+		if got := testutil.ToFloat64(metrics.WorkerBatches.WithLabelValues(w.subject, result)); got != expected {
+			t.Errorf("batches %s: expected %v, got %v", result, expected, got)
+		}
+	}
+	if got := testutil.ToFloat64(metrics.WorkerMessages.WithLabelValues(w.subject, "ok")); got != 2 {
+		t.Errorf("expected 2 sent messages, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.WorkerBuffered.WithLabelValues(w.subject)); got != 0 {
+		t.Errorf("expected empty buffer after stop, got %v", got)
+	}
+}
+
+func TestWorkerAddDoesNotWaitForSend(t *testing.T) {
+	sender := newFakeSender()
+	sender.block = make(chan struct{})
+	w := NewWorker[int](nil, sender, 1, time.Hour)
+	w.run()
+
+	// Пока первая пачка отправляется, следующие встают в очередь, а не ждут отправки.
+	added := make(chan struct{})
+	go func() {
+		for i := 1; i <= 3; i++ {
+			w.add(i, trace.Link{})
+		}
+		close(added)
+	}()
+	select {
+	case <-added:
+	case <-time.After(time.Second):
+		t.Fatal("add is blocked by send")
+	}
+
+	close(sender.block)
+	if err := w.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if batches := sender.Batches(); len(batches) != 3 || batches[0][0] != 1 || batches[2][0] != 3 {
+		t.Fatalf("expected three batches in order, got %v", batches)
+	}
+}
+
+func TestWorkerStopCancelsSend(t *testing.T) {
+	sender := newFakeSender()
+	sender.block = make(chan struct{})
+	w := NewWorker[int](nil, sender, 1, time.Hour)
+	w.run()
+
+	w.add(1, trace.Link{})
+	sender.wait(t, time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	stopped := make(chan error)
+	go func() { stopped <- w.Stop(ctx) }()
+	select {
+	case err := <-stopped:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected deadline exceeded, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stop is blocked by send")
+	}
+}
+
+func TestWorkerStopNotStarted(t *testing.T) {
+	w := NewWorker[int](nil, newFakeSender(), 10, time.Hour)
+	stopped := make(chan error)
+	go func() { stopped <- w.Stop(context.Background()) }()
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stop of not started worker is blocked")
+	}
+}
+
+func TestWorkerStopTwice(t *testing.T) {
+	sender := newFakeSender()
+	w := NewWorker[int](nil, sender, 10, time.Hour)
+	w.run()
+	w.add(1, trace.Link{})
+	for i := 0; i < 2; i++ {
+		if err := w.Stop(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if batches := sender.Batches(); len(batches) != 1 {
+		t.Fatalf("expected one batch, got %v", batches)
+	}
+}
@@ -0,0 +1,121 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DB - пул соединений, который пишет спан на каждый запрос, в том числе внутри транзакций.
+// Имя спана берется из комментария sqlc "-- name: GetGood :one", если он есть.
+type DB struct {
+	*pgxpool.Pool
+}
+
+func NewDB(pool *pgxpool.Pool) *DB {
+	return &DB{
+		Pool: pool,
+	}
+}
+
+func (db *DB) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	ctx, span := querySpan(ctx, sql)
+	tag, err := db.Pool.Exec(ctx, sql, args...)
+	End(span, err)
+	return tag, err
+}
+
+func (db *DB) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	ctx, span := querySpan(ctx, sql)
+	rows, err := db.Pool.Query(ctx, sql, args...)
+	End(span, err)
+	return rows, err
+}
+
+func (db *DB) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	ctx, span := querySpan(ctx, sql)
+	return &row{Row: db.Pool.QueryRow(ctx, sql, args...), span: span}
+}
+
+func (db *DB) Begin(ctx context.Context) (pgx.Tx, error) {
+	pgxTx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &tx{Tx: pgxTx}, nil
+}
+
+// tx - транзакция, которая пишет спан на каждый запрос.
+type tx struct {
+	pgx.Tx
+}
+
+func (t *tx) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	ctx, span := querySpan(ctx, sql)
+	tag, err := t.Tx.Exec(ctx, sql, args...)
+	End(span, err)
+	return tag, err
+}
+
+func (t *tx) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	ctx, span := querySpan(ctx, sql)
+	rows, err := t.Tx.Query(ctx, sql, args...)
+	End(span, err)
+	return rows, err
+}
+
+func (t *tx) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	ctx, span := querySpan(ctx, sql)
+	return &row{Row: t.Tx.QueryRow(ctx, sql, args...), span: span}
+}
+
+// row - завершает спан запроса при чтении строки, pgx выполняет QueryRow только в Scan.
+type row struct {
+	pgx.Row
+	span trace.Span
+}
+
+func (r *row) Scan(dest ...interface{}) error {
+	err := r.Row.Scan(dest...)
+	// Отсутствие строки - обычный результат, а не ошибка запроса.
+	if errors.Is(err, pgx.ErrNoRows) {
+		r.span.End()
+		return err
+	}
+	End(r.span, err)
+	return err
+}
+
+// querySpan - спан запроса. Запросы вне трейса, например опрос outbox, не записываются.
+func querySpan(ctx context.Context, sql string) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	return Tracer().Start(ctx, "postgres "+queryName(sql),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBStatement(sql),
+		),
+	)
+}
+
+// queryName - имя запроса sqlc из первой строки, иначе первое слово запроса.
+func queryName(sql string) string {
+	sql = strings.TrimSpace(sql)
+	if rest, ok := strings.CutPrefix(sql, "-- name: "); ok {
+		if name, _, ok := strings.Cut(rest, " "); ok {
+			return name
+		}
+	}
+	if op, _, ok := strings.Cut(sql, " "); ok {
+		return strings.ToUpper(op)
+	}
+	return strings.ToUpper(sql)
+}
@@ -0,0 +1,67 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var _ redis.Hook = RedisHook{}
+
+// RedisHook - хук redis клиента, который пишет спан на каждую команду и пайплайн.
+// Команды вне трейса, например PING из tools.RedisGuard, не записываются.
+type RedisHook struct{}
+
+func (RedisHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (RedisHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if !trace.SpanContextFromContext(ctx).IsValid() {
+			return next(ctx, cmd)
+		}
+		ctx, span := redisSpan(ctx, "redis "+cmd.Name(), cmd.Name())
+		err := next(ctx, cmd)
+		End(span, redisError(err))
+		return err
+	}
+}
+
+func (RedisHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if !trace.SpanContextFromContext(ctx).IsValid() {
+			return next(ctx, cmds)
+		}
+		names := make([]string, 0, len(cmds))
+		for _, cmd := range cmds {
+			names = append(names, cmd.Name())
+		}
+		ctx, span := redisSpan(ctx, "redis pipeline", strings.Join(names, " "))
+		err := next(ctx, cmds)
+		End(span, redisError(err))
+		return err
+	}
+}
+
+func redisSpan(ctx context.Context, name, statement string) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemRedis,
+			semconv.DBStatement(statement),
+		),
+	)
+}
+
+// redisError - промах кеша (redis.Nil) не считается ошибкой.
+func redisError(err error) error {
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,122 @@
+// Package tracing - трейсы OpenTelemetry: настройка экспорта и обертки для postgres, redis и nats.
+// Контекст трейса передается между сервисами в заголовках в формате W3C traceparent.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/nats-io/nats.go"
+	"github.com/yudgxe/hezzl-test/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentation = "github.com/yudgxe/hezzl-test"
+
+// Tracer - трейсер для спанов сервиса.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+// Setup - настраивает глобальные провайдер трейсов и propagator. Возвращает функцию, которая
+// отправляет оставшиеся спаны и закрывает экспорт, ее нужно вызвать при остановке.
+func Setup(ctx context.Context, cfg config.Tracing, service string) (func(ctx context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var file *os.File
+	var err error
+	switch cfg.Exporter {
+	case "none":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		exporter, err = stdouttrace.New()
+	case "file":
+		file, err = os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+	case "otlp":
+		exporter, err = otlptracehttp.New(ctx, otlptracehttp.WithEndpoint(cfg.OTLPEndpoint), otlptracehttp.WithInsecure())
+	default:
+		return nil, fmt.Errorf("unknown exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(service))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			err = errors.Join(err, file.Close())
+		}
+		return err
+	}, nil
+}
+
+// InjectNATS - пишет контекст трейса из ctx в заголовки сообщения.
+func InjectNATS(ctx context.Context, msg *nats.Msg) {
+	if msg.Header == nil {
+		msg.Header = nats.Header{}
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(msg.Header))
+}
+
+// ExtractNATS - контекст трейса из заголовков сообщения.
+func ExtractNATS(ctx context.Context, msg *nats.Msg) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(msg.Header))
+}
+
+// LinkNATS - ссылка на спан, который отправил сообщение, для спана обработки пачки сообщений.
+func LinkNATS(msg *nats.Msg) trace.Link {
+	return trace.LinkFromContext(ExtractNATS(context.Background(), msg))
+}
+
+// Headers - контекст трейса из ctx в виде заголовков, чтобы сохранить его вместе с событием.
+func Headers(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	return carrier
+}
+
+// FromHeaders - контекст трейса из сохраненных заголовков.
+func FromHeaders(ctx context.Context, headers map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(headers))
+}
+
+// PublishSpan - спан отправки сообщения в тему subject.
+func PublishSpan(ctx context.Context, subject string) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, "publish "+subject,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("nats"),
+			semconv.MessagingDestinationName(subject),
+		),
+	)
+}
+
+// End - завершает спан, отмечая ошибку, если она есть.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
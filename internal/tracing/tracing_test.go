@@ -0,0 +1,55 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestQueryName(t *testing.T) {
+	for sql, expected := range map[string]string{
+		"-- name: GetGood :one\nSELECT * FROM goods WHERE id = $1": "GetGood",
+		"  select 1":   "SELECT",
+		"BEGIN":        "BEGIN",
+		"-- name: Bad": "--",
+	} {
+		if got := queryName(sql); got != expected {
+			t.Errorf("%q: expected %q, got %q", sql, expected, got)
+		}
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	ctx, request := Tracer().Start(context.Background(), "request")
+	defer request.End()
+
+	// Событие из outbox отправляется в трейсе запроса, а воркер получает ссылку на спан отправки.
+	headers := Headers(ctx)
+	if headers["traceparent"] == "" {
+		t.Fatalf("expected traceparent in headers, got %v", headers)
+	}
+	publishCtx, publish := PublishSpan(FromHeaders(context.Background(), headers), "logs.good")
+	msg := nats.NewMsg("logs.good")
+	InjectNATS(publishCtx, msg)
+	End(publish, nil)
+
+	if parent := recorder.Ended()[0].Parent(); parent.SpanID() != request.SpanContext().SpanID() {
+		t.Errorf("expected publish span to be a child of request, got parent %s", parent.SpanID())
+	}
+	link := LinkNATS(msg)
+	if link.SpanContext.TraceID() != request.SpanContext().TraceID() || link.SpanContext.SpanID() != publish.SpanContext().SpanID() {
+		t.Errorf("expected link to publish span %s, got %s", publish.SpanContext().SpanID(), link.SpanContext.SpanID())
+	}
+}
@@ -2,35 +2,54 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
 	"strings"
 
 	"github.com/uptrace/go-clickhouse/ch"
 	"github.com/uptrace/go-clickhouse/chdebug"
 	"github.com/uptrace/go-clickhouse/chmigrate"
+	"github.com/yudgxe/hezzl-test/internal/config"
 	"github.com/yudgxe/hezzl-test/migrations/clickhouse/migrations"
 
 	"github.com/urfave/cli/v2"
 )
 
-var (
-	host string
-	port int
-)
-
-func init() {
-	flag.StringVar(&host, "host", "localhost", "clickhouse хост")
-	flag.IntVar(&port, "port", 9000, "clickhouse порт")
-
-	flag.Parse()
+// removedFlags - флаги прежнего мигратора. В общих настройках -host и -port - адрес api,
+// поэтому без этой проверки мигратор молча подключился бы к clickhouse по умолчанию.
+var removedFlags = config.Removed{
+	"host": "use -clickhouse-addr host:port",
+	"port": "use -clickhouse-addr host:port",
 }
 
 func main() {
+	cfg, rest, printed, err := config.Parse("ch", os.Args[1:], removedFlags)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if printed {
+		return
+	}
+	// Мигратору нужен только clickhouse, настройки api не должны мешать миграциям.
+	if err := cfg.ClickHouse.Validate(); err != nil {
+		log.Fatal(err)
+	}
 
-	db := ch.Connect(ch.WithDSN(fmt.Sprintf("clickhouse://%s:%d/logs?sslmode=disable", host, port)))
+	dsn := url.URL{
+		Scheme:   "clickhouse",
+		User:     url.UserPassword(cfg.ClickHouse.Username, cfg.ClickHouse.Password),
+		Host:     cfg.ClickHouse.Addr,
+		Path:     cfg.ClickHouse.Database,
+		RawQuery: "sslmode=disable",
+	}
+	db := ch.Connect(ch.WithDSN(dsn.String()))
 	db.AddQueryHook(chdebug.NewQueryHook(
 		chdebug.WithEnabled(false),
 		chdebug.FromEnv("CHDEBUG"),
@@ -46,7 +65,7 @@ func main() {
 			newDBCommand(db, chmigrate.NewMigrator(db, migrations.Migrations)),
 		},
 	}
-	if err := app.Run(os.Args); err != nil {
+	if err := app.Run(append([]string{os.Args[0]}, rest...)); err != nil {
 		log.Fatal(err)
 	}
 
@@ -0,0 +1,4 @@
+ALTER TABLE logs.goods
+    DROP COLUMN IF EXISTS event_type,
+    DROP COLUMN IF EXISTS actor,
+    DROP COLUMN IF EXISTS request_id;
@@ -0,0 +1,4 @@
+ALTER TABLE logs.goods
+    ADD COLUMN IF NOT EXISTS event_type LowCardinality(String) DEFAULT '',
+    ADD COLUMN IF NOT EXISTS actor String DEFAULT '',
+    ADD COLUMN IF NOT EXISTS request_id String DEFAULT '';
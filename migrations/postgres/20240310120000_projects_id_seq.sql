@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Тестовый проект добавлен с явным id, поэтому сдвигаем последовательность,
+-- иначе первый созданный через api проект получит id = 1.
+SELECT setval('projects_id_seq', COALESCE((SELECT MAX(id) FROM projects), 0) + 1, false);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 1;
+-- +goose StatementEnd
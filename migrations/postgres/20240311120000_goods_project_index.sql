@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Список и метаданные товаров фильтруются по проекту.
+CREATE INDEX ix_goods_project_id_id ON goods (project_id, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS ix_goods_project_id_id;
+-- +goose StatementEnd
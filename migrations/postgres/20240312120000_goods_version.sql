@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Версия товара для оптимистичной блокировки, увеличивается при любом изменении.
+ALTER TABLE goods ADD COLUMN version integer NOT NULL DEFAULT 1;
+
+CREATE FUNCTION increment_version() RETURNS TRIGGER AS $$
+    BEGIN
+        NEW.version = OLD.version + 1;
+        RETURN NEW;
+    END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER goods_increment_version
+BEFORE UPDATE ON goods
+FOR EACH ROW EXECUTE FUNCTION increment_version();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS goods_increment_version ON goods;
+DROP FUNCTION IF EXISTS increment_version();
+ALTER TABLE goods DROP COLUMN IF EXISTS version;
+-- +goose StatementEnd
@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Ключи api, сам ключ не хранится, только sha256 от него.
+CREATE TABLE api_keys (
+    id serial PRIMARY KEY,
+    name varchar(255) NOT NULL,
+    key_hash varchar(64) NOT NULL UNIQUE,
+    -- Доступ ко всем проектам и админским ручкам.
+    is_admin boolean NOT NULL DEFAULT FALSE,
+    created_at timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    revoked_at timestamptz
+);
+
+-- Проекты, к которым есть доступ у ключа.
+CREATE TABLE api_key_projects (
+    api_key_id integer NOT NULL REFERENCES api_keys (id) ON DELETE CASCADE,
+    project_id integer NOT NULL REFERENCES projects (id) ON DELETE CASCADE,
+    -- read - только чтение, write - чтение и изменение.
+    scope varchar(16) NOT NULL CHECK (scope IN ('read', 'write')),
+    PRIMARY KEY (api_key_id, project_id)
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS api_key_projects;
+DROP TABLE IF EXISTS api_keys;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+-- События для nats, пишутся в одной транзакции с изменением и отправляются relay.
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id bigserial PRIMARY KEY,
+    subject varchar(255) NOT NULL,
+    payload jsonb NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sent_at timestamptz,
+    attempts integer NOT NULL DEFAULT 0,
+    last_error text
+);
+
+CREATE INDEX IF NOT EXISTS outbox_events_pending_idx ON outbox_events (id) WHERE sent_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS outbox_events;
+-- +goose StatementEnd
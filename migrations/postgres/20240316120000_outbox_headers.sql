@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Заголовки nats сообщения, в них передается контекст трейса запроса, создавшего событие.
+ALTER TABLE outbox_events ADD COLUMN IF NOT EXISTS headers jsonb NOT NULL DEFAULT '{}';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE outbox_events DROP COLUMN IF EXISTS headers;
+-- +goose StatementEnd